@@ -0,0 +1,56 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Agent describes an agent connected to the stream.
+type Agent struct {
+	// AgentID is the ID the agent identified with, if any.
+	AgentID    string   `json:"agent_id,omitempty"`
+	RemoteAddr string   `json:"remote_addr"`
+	Topics     []string `json:"topics"`
+	// Subprotocol is the encoding negotiated by the agent, if any.
+	Subprotocol string `json:"subprotocol,omitempty"`
+	// Compressed is true if the agent negotiated permessage-deflate.
+	Compressed  bool      `json:"compressed,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// Agents returns the agents connected to the
+// stream, sorted by the time they connected.
+func (s *Sender) Agents() []Agent {
+	agents := []Agent{}
+	for _, c := range s.hub.Conns() {
+		sub := c.Value().(*subscriber)
+		agents = append(agents, Agent{
+			AgentID:     sub.agentID,
+			RemoteAddr:  sub.remoteAddr,
+			Topics:      sub.topics,
+			Subprotocol: c.Subprotocol(),
+			Compressed:  sub.compress,
+			ConnectedAt: sub.connectedAt,
+		})
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].ConnectedAt.Before(agents[j].ConnectedAt)
+	})
+	return agents
+}
+
+// agentsHandler returns the agents connected to the stream.
+func (a *API) agentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.sender.Agents())
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestAgentsHandler(t *testing.T) {
+	logger := log.New()
+	s := NewSender(logger, SenderConfig{HTTPStream: "stream", Topics: []string{"agent-control"}})
+	api := NewAPI(0, s, mockStorage{}, logger, nil)
+	srv := httptest.NewServer(api.mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	for i, c := range []struct{ path, agentID string }{{"/stream", "agent-1"}, {"/stream/agent-control", "agent-2"}} {
+		conn, _, err := websocket.DefaultDialer.Dial(url+c.path, http.Header{"X-Agent-ID": {c.agentID}})
+		if err != nil {
+			t.Fatalf("expected no error connecting but got: %v", err)
+		}
+		defer conn.Close()
+		waitSubscribers(t, s, i+1)
+	}
+
+	rec := httptest.NewRecorder()
+	api.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/agents", nil))
+	var agents []Agent
+	if err := json.Unmarshal(rec.Body.Bytes(), &agents); err != nil {
+		t.Fatalf("expected no error decoding agents but got: %v", err)
+	}
+	if len(agents) != 2 {
+		t.Fatalf("expected 2 agents but got %+v", agents)
+	}
+	for i, want := range []struct{ agentID, topic string }{{"agent-1", "stream"}, {"agent-2", "agent-control"}} {
+		a := agents[i]
+		if a.AgentID != want.agentID || strings.Join(a.Topics, ",") != want.topic || a.RemoteAddr == "" || a.ConnectedAt.IsZero() {
+			t.Errorf("unexpected agent %d %+v", i, a)
+		}
+	}
+}
@@ -6,10 +6,15 @@ package stream
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"sync"
+	"time"
 
 	metrics "github.com/adevinta/vulcan-metrics-client"
 	"github.com/sirupsen/logrus"
@@ -18,18 +23,37 @@ import (
 const (
 	// abort check action
 	actionAbort = "abort"
+	// revoke is the audit action of removing
+	// a check from the aborted checks.
+	actionRevoke = "revoke"
 
 	// metrics
 	metricNotified    = "vulcan.stream.mssgs.notified"
 	metricBroadcasted = "vulcan.stream.mssgs.broadcasted"
 
 	componentTag = "component:stream"
+
+	// requestIDHeader is the header used to read and return the
+	// ID of the requests, which is included in their logs.
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLen is the maximum length of the
+	// request IDs accepted from the callers.
+	maxRequestIDLen = 128
 )
 
 // APIConfig represents the config
 // necessary for stream API.
 type APIConfig struct {
 	Port int
+	// Actions are the actions of the messages that
+	// can be published through the /messages endpoint.
+	Actions []string
+	// CacheMaxAge is the number of hours the local cache can go
+	// without being synced before the stream is not ready.
+	CacheMaxAge int
+	// ScheduleInterval is the number of seconds between
+	// the checks for due scheduled aborts.
+	ScheduleInterval int
 }
 
 // API represents the stream REST API.
@@ -40,17 +64,71 @@ type API struct {
 	metrics metrics.Client
 	mux     *http.ServeMux
 	port    int
+
+	promPath    string
+	cacheMaxAge time.Duration
+
+	audit          AuditLog
+	identityHeader string
+
+	actions map[string]bool
+
+	limiter        *clientLimiter
+	subscribers    *subscriberLimits
+	clientIPHeader string
+
+	scheduled        ScheduleDB
+	scheduleInterval time.Duration
+
+	webhooks *Webhooks
+
+	source     Source
+	sourceName string
+	dedup      Deduper
+	dedupTTL   time.Duration
+}
+
+// APIOption configures optional features of the API.
+type APIOption func(*API)
+
+// WithPrometheus exposes the Prometheus metrics of the stream
+// at the given path. If path is empty, /metrics is used.
+func WithPrometheus(path string) APIOption {
+	return func(a *API) {
+		if path == "" {
+			path = defPrometheusPath
+		}
+		a.promPath = path
+	}
 }
 
 // AbortRequest represents the body
 // for an abort cheks request.
 type AbortRequest struct {
 	Checks []string `json:"checks"`
+	// ScanID optionally identifies the scan the checks belong to.
+	ScanID string `json:"scan_id,omitempty"`
+	// Topic is the stream topic the abort messages are
+	// published to. Defaults to the default topic.
+	Topic string `json:"topic,omitempty"`
+	// At optionally schedules the abort to be performed
+	// at that time instead of immediately.
+	At time.Time `json:"at,omitzero"`
+}
+
+// badRequest wraps the errors caused by an invalid request,
+// which are returned to the caller as 400 Bad Request.
+type badRequest struct {
+	error
+}
+
+func (e badRequest) Unwrap() error {
+	return e.error
 }
 
 // NewAPI builds a new stream  API.
 func NewAPI(port int, sender *Sender, storage Storage, logger logrus.FieldLogger,
-	metrics metrics.Client) *API {
+	metrics metrics.Client, opts ...APIOption) *API {
 
 	a := &API{
 		sender:  sender,
@@ -59,71 +137,326 @@ func NewAPI(port int, sender *Sender, storage Storage, logger logrus.FieldLogger
 		metrics: metrics,
 		mux:     http.NewServeMux(),
 		port:    port,
+
+		cacheMaxAge: defCacheMaxAge,
+		actions:     map[string]bool{actionAbort: true},
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
 
-	a.mux.HandleFunc("/stream", a.connHandler)
-	a.mux.HandleFunc("/checks", a.checksHandler)
-	a.mux.HandleFunc("/abort", a.abortHandler)
-	a.mux.HandleFunc("/status", a.statusHandler)
+	a.mux.HandleFunc("/stream", a.withRequestID(a.connHandler))
+	a.mux.HandleFunc("/stream/{topic}", a.withRequestID(a.connHandler))
+	a.handle("/checks", a.rateLimited(a.checksHandler))
+	a.handle("/checks/{id}", a.rateLimited(a.checkHandler))
+	a.handle("/agents", a.rateLimited(a.agentsHandler))
+	a.handle("/abort", a.rateLimited(a.abortHandler))
+	a.handle("/messages", a.rateLimited(a.messagesHandler))
+	a.handle("/status", a.statusHandler)
+	a.handle("/schema/message.json", a.schemaHandler)
+	a.handle("/schema/message.proto", a.protoHandler)
+	a.handle("/keys", a.keysHandler)
+	a.handle("/healthz", a.healthzHandler)
+	a.handle("/readyz", a.readyzHandler)
+	if a.audit != nil {
+		a.handle("/audit", a.rateLimited(a.auditHandler))
+	}
+	if a.scheduled != nil {
+		a.handle("/aborts/scheduled", a.rateLimited(a.scheduledHandler))
+		a.handle("/aborts/scheduled/{id}", a.rateLimited(a.cancelScheduledHandler))
+	}
+	if a.webhooks != nil {
+		a.handle("/webhooks/dead", a.rateLimited(a.deadLettersHandler))
+	}
+	if a.promPath != "" {
+		a.mux.Handle(a.promPath, PrometheusHandler())
+	}
 
 	return a
 }
 
-// Start starts the stream API.
-func (a *API) Start() {
+// Start starts the API and blocks until ctx is done. Then it stops
+// performing the scheduled aborts and consuming commands, closing
+// the source, and shuts down the server.
+func (a *API) Start(ctx context.Context) {
 	a.logger.WithFields(logrus.Fields{
 		"details": a.port,
 	}).Info("Vulcan Stream API started")
 
 	go a.sender.Start()
+	var wg sync.WaitGroup
+	if a.scheduled != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.runScheduler(ctx)
+		}()
+	}
+	if a.source != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.ingest(ctx)
+			if err := a.source.Close(); err != nil {
+				a.logger.WithError(err).Error("Error closing the ingest source")
+			}
+		}()
+	}
+
+	srv := &http.Server{Addr: fmt.Sprintf(":%v", a.port), Handler: a.mux}
+	go func() {
+		<-ctx.Done()
+		if err := srv.Shutdown(context.Background()); err != nil {
+			a.logger.WithError(err).Error("Error shutting down the API")
+		}
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		a.logger.Panic(err)
+	}
+	wg.Wait()
+	a.logger.Info("Vulcan Stream API stopped")
+}
+
+// ServeHTTP serves the API routes, so the API can also
+// be served by servers other than the one run by Start.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// handle registers h for the given route, recording
+// metrics, traces and a request ID for every request.
+func (a *API) handle(route string, h http.HandlerFunc) {
+	a.mux.HandleFunc(route, instrument(route, traced(route, a.withRequestID(h))))
+}
 
-	a.logger.Panic(http.ListenAndServe(fmt.Sprintf(":%v", a.port), a.mux))
+// withRequestID assigns an ID to every request handled by h, taken
+// from the X-Request-ID header if present, and returns it in the
+// same response header. The ID is included in the logs written
+// with the logger carried by the request context.
+func (a *API) withRequestID(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLen {
+			id = newUUID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		logger := a.logger.WithField("request_id", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		h(w, r.WithContext(withLogger(ctx, logger)))
+	}
 }
 
-// connHandler handles a new connection to the stream.
+type requestIDKey struct{}
+
+// requestIDFrom returns the ID of the request being served in ctx, if any.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// connHandler handles a new connection to the stream topic in the
+// path, or to the default topic if there is none. If a subscriber
+// limit is reached, the connection is closed with the reason.
 func (a *API) connHandler(w http.ResponseWriter, r *http.Request) {
-	a.sender.HandleConn(w, r)
+	var topics []string
+	if topic := r.PathValue("topic"); topic != "" {
+		if !a.sender.HasTopic(topic) {
+			http.Error(w, fmt.Sprintf("unknown topic %q", topic), http.StatusNotFound)
+			return
+		}
+		topics = append(topics, topic)
+	}
+
+	if a.subscribers == nil {
+		a.sender.HandleConn(w, r, topics...)
+		return
+	}
+
+	release, limit, reason := a.subscribers.acquire(AgentID(r), a.clientIP(r))
+	if release == nil {
+		promLimited.WithLabelValues(limit).Inc()
+		logger := loggerFrom(r.Context(), a.logger).WithField("agent_id", AgentID(r))
+		logger.WithField("reason", reason).Warn("Subscriber rejected")
+		if err := rejectSubscriber(w, r, reason); err != nil {
+			logger.WithError(err).Error("Error rejecting subscriber")
+		}
+		return
+	}
+
+	// The slot is freed when the websocket is closed or,
+	// if the connection was not upgraded, right away.
+	hw := onHijack(w, func() {}, release)
+	a.sender.HandleConn(hw, r, topics...)
+	if !hw.hijacked {
+		release()
+	}
 }
 
 // checksHandler returns the list of currently aborted checks.
 func (a *API) checksHandler(w http.ResponseWriter, r *http.Request) {
-	checks, err := a.storage.GetAbortedChecks(context.Background())
+	checks, err := a.storage.GetAbortedChecks(r.Context())
 	if err != nil {
-		writeErr(w, err)
+		a.writeErr(w, r, err)
 		return
 	}
 
 	checksArray, err := json.Marshal(checks)
 	if err != nil {
-		writeErr(w, err)
+		a.writeErr(w, r, err)
 		return
 	}
 
 	w.Write(checksArray)
 }
 
-// abortHandler handles an abort checks request.
+// CheckStatus is the abort status of a check.
+type CheckStatus struct {
+	CheckID string `json:"check_id"`
+	Aborted bool   `json:"aborted"`
+}
+
+// checkHandler returns whether the check in the path is aborted or,
+// on DELETE, revokes its abort so it is no longer reported as aborted
+// to the agents asking for the aborted checks. The check IDs are not
+// known in advance, so unknown checks are reported as not aborted.
+func (a *API) checkHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		checks, err := a.storage.GetAbortedChecks(r.Context())
+		if err != nil {
+			a.writeErr(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CheckStatus{CheckID: id, Aborted: slices.Contains(checks, id)})
+	case http.MethodDelete:
+		err := a.storage.RemoveAbortedChecks(context.WithoutCancel(r.Context()), []string{id})
+		a.recordAudit(r, actionRevoke, []string{id}, "", err)
+		if err != nil {
+			a.writeErr(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// abortHandler handles an abort checks request. The aborts
+// scheduled for later are returned as 202 Accepted.
 func (a *API) abortHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	// Do not stop storing and broadcasting the
+	// checks if the caller goes away, but keep
+	// the trace started for the request.
+	ctx := context.WithoutCancel(r.Context())
+
+	var req AbortRequest
+	scheduled, err := a.abort(ctx, r, &req)
+	action := actionAbort
+	if scheduled != nil || (err != nil && !req.At.IsZero()) {
+		action = actionScheduleAbort
+	}
+	a.recordAudit(r, action, req.Checks, req.ScanID, err)
 	if err != nil {
-		writeErr(w, err)
+		a.writeErr(w, r, err)
 		return
 	}
+	if scheduled != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(scheduled)
+	}
+}
 
-	var req AbortRequest
-	err = json.Unmarshal(body, &req)
+// abort reads the abort request from r into req, stores
+// the checks as aborted and broadcasts them to the agents.
+// If the request is for a future time, the abort is scheduled
+// instead and returned.
+func (a *API) abort(ctx context.Context, r *http.Request, req *AbortRequest) (*ScheduledAbort, error) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		writeErr(w, err)
-		return
+		return nil, err
 	}
 
-	err = a.storage.AddAbortedChecks(context.Background(), req.Checks)
+	err = json.Unmarshal(body, req)
 	if err != nil {
-		writeErr(w, err)
-		return
+		return nil, err
 	}
+	return a.performAbort(ctx, req)
+}
 
-	a.incrNotifiedMssgs(len(req.Checks))
+// performAbort stores the checks in req as aborted and broadcasts
+// them to the agents, or schedules them to be aborted later.
+func (a *API) performAbort(ctx context.Context, req *AbortRequest) (*ScheduledAbort, error) {
+	topic, err := a.topic(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.At.After(time.Now()) {
+		return a.schedule(ctx, topic, req)
+	}
+	return nil, a.dispatch(ctx, topic, abortMessages(req.Checks, req.ScanID))
+}
+
+// abortMessages returns the messages to abort the checks.
+func abortMessages(checks []string, scanID string) []Message {
+	msgs := make([]Message, 0, len(checks))
+	for _, c := range checks {
+		msgs = append(msgs, Message{
+			CheckID: c,
+			ScanID:  scanID,
+			Action:  actionAbort,
+		})
+	}
+	return msgs
+}
+
+// topic returns the given topic, or the default one if it is
+// empty. It returns a badRequest error if the topic is not served.
+func (a *API) topic(topic string) (string, error) {
+	if topic == "" {
+		topic = a.sender.config.HTTPStream
+	}
+	if !a.sender.HasTopic(topic) {
+		return "", badRequest{fmt.Errorf("unknown topic %q", topic)}
+	}
+	return topic, nil
+}
+
+// dispatch publishes msgs to the topic. The checks of the abort
+// messages are stored as aborted first, so they are returned by
+// /checks before the agents receive the messages, and nothing is
+// published if they can't be stored.
+func (a *API) dispatch(ctx context.Context, topic string, msgs []Message) error {
+	var (
+		aborted []string
+		// scans are the scan IDs of the aborted checks, in order,
+		// and byScan the checks of each of them, so an event is
+		// notified for every scan.
+		scans  []string
+		byScan = make(map[string][]string)
+	)
+	for _, m := range msgs {
+		if m.Action != actionAbort {
+			continue
+		}
+		aborted = append(aborted, m.CheckID)
+		if _, ok := byScan[m.ScanID]; !ok {
+			scans = append(scans, m.ScanID)
+		}
+		byScan[m.ScanID] = append(byScan[m.ScanID], m.CheckID)
+	}
+	if len(aborted) > 0 {
+		if err := a.storage.AddAbortedChecks(ctx, aborted); err != nil {
+			return err
+		}
+		a.incrNotifiedMssgs(len(aborted))
+		for _, scanID := range scans {
+			a.webhooks.Notify(Event{Type: EventCheckAborted, CheckIDs: byScan[scanID], ScanID: scanID})
+		}
+	}
 
 	// TODO: should we broadcast
 	// checks async once they are
@@ -133,20 +466,23 @@ func (a *API) abortHandler(w http.ResponseWriter, r *http.Request) {
 	// and a goroutine which consumes
 	// from that.
 
-	for _, c := range req.Checks {
-		m := Message{
-			CheckID: c,
-			Action:  actionAbort,
-		}
-		a.sender.Broadcast(m)
+	for _, m := range msgs {
+		a.sender.Publish(ctx, topic, m)
 		a.incrBroadcastedMssgs(m)
 	}
+	return nil
 }
 
 func (a *API) statusHandler(w http.ResponseWriter, r *http.Request) { /* 200 OK */ }
 
-func writeErr(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusInternalServerError)
+// writeErr logs err with the request logger and returns it to the caller.
+func (a *API) writeErr(w http.ResponseWriter, r *http.Request, err error) {
+	loggerFrom(r.Context(), a.logger).WithError(err).WithField("path", r.URL.Path).Error("Error handling request")
+	code := http.StatusInternalServerError
+	if errors.As(err, &badRequest{}) {
+		code = http.StatusBadRequest
+	}
+	w.WriteHeader(code)
 	w.Write([]byte(fmt.Sprintf("err: %v", err)))
 }
 
@@ -167,3 +503,13 @@ func (a *API) incrBroadcastedMssgs(m Message) {
 		Tags:  []string{componentTag, fmt.Sprint("action:", m.Action)},
 	})
 }
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	// rand.Read never returns an error.
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
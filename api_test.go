@@ -0,0 +1,65 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// memStorage keeps the aborted checks in memory.
+type memStorage struct {
+	mockStorage
+	checks []string
+}
+
+func (s *memStorage) GetAbortedChecks(ctx context.Context) ([]string, error) {
+	return s.checks, nil
+}
+
+func (s *memStorage) RemoveAbortedChecks(ctx context.Context, checks []string) error {
+	s.checks = slices.DeleteFunc(s.checks, func(c string) bool { return slices.Contains(checks, c) })
+	return nil
+}
+
+func TestCheckHandler(t *testing.T) {
+	logger := log.New()
+	storage := &memStorage{checks: []string{"c1", "c2"}}
+	api := NewAPI(0, NewSender(logger, SenderConfig{}), storage, logger, nil)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		api.mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	aborted := func(id string) bool {
+		t.Helper()
+		var st CheckStatus
+		rec := do(http.MethodGet, "/checks/"+id)
+		if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil || st.CheckID != id {
+			t.Fatalf("unexpected check status %s, error: %v", rec.Body, err)
+		}
+		return st.Aborted
+	}
+
+	if !aborted("c1") || aborted("c3") {
+		t.Fatal("expected only c1 to be aborted")
+	}
+	if rec := do(http.MethodDelete, "/checks/c1"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d revoking but got %d: %s", http.StatusNoContent, rec.Code, rec.Body)
+	}
+	if aborted("c1") || !aborted("c2") {
+		t.Errorf("expected only c2 to be aborted but got %v", storage.checks)
+	}
+	if rec := do(http.MethodPost, "/checks/c2"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code %d but got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
@@ -0,0 +1,371 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// AuditSinkFile appends the audit entries to a file, one JSON object per line.
+	AuditSinkFile = "file"
+	// AuditSinkRedis appends the audit entries to a Redis stream.
+	AuditSinkRedis = "redis"
+
+	defAuditStream   = "vulcan-stream:audit"
+	defAuditQueryMax = 1000
+	auditPageSize    = 500
+
+	auditOutcomeSuccess = "success"
+	auditOutcomeError   = "error"
+)
+
+// AuditConfig defines the configuration of the audit log.
+type AuditConfig struct {
+	// Sink is where the audit entries are written to, either file or
+	// redis. If empty, the audit log is disabled.
+	Sink string
+	// File is the file the entries are appended to when Sink is file.
+	File string
+	// Stream is the key of the Redis stream the entries are appended
+	// to when Sink is redis. By default, vulcan-stream:audit is used.
+	Stream string
+	// MaxLen is the approximate maximum number of entries kept in the
+	// Redis stream. Zero keeps all of them.
+	MaxLen int64
+	// IdentityHeader is the request header the identity of the caller
+	// is read from, e.g. the one set by an authenticating proxy.
+	IdentityHeader string
+}
+
+// AuditEntry is a record of an action performed through the API.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Identity  string    `json:"identity,omitempty"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	CheckIDs  []string  `json:"check_ids,omitempty"`
+	ScanID    string    `json:"scan_id,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// hasCheck reports whether the entry refers to the given check.
+func (e AuditEntry) hasCheck(checkID string) bool {
+	for _, c := range e.CheckIDs {
+		if c == checkID {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditQuery selects audit entries.
+type AuditQuery struct {
+	// CheckID, if not empty, selects the entries of the given check.
+	CheckID string
+	// Since, if not zero, selects the entries recorded from then on.
+	Since time.Time
+	// Limit is the maximum number of entries returned.
+	Limit int
+}
+
+// matches reports whether the entry is selected by the query.
+func (q AuditQuery) matches(e AuditEntry) bool {
+	if q.CheckID != "" && !e.hasCheck(q.CheckID) {
+		return false
+	}
+	return q.Since.IsZero() || !e.Time.Before(q.Since)
+}
+
+// AuditLog is an append-only record of the actions performed through the API.
+type AuditLog interface {
+	Record(ctx context.Context, e AuditEntry) error
+	Query(ctx context.Context, q AuditQuery) ([]AuditEntry, error)
+}
+
+// NewAuditLog builds the audit log for the given configuration.
+// The Redis sink uses the same Redis as the storage. It returns
+// nil if the audit log is disabled.
+func NewAuditLog(c AuditConfig, db *RedisDB) (AuditLog, error) {
+	switch c.Sink {
+	case "":
+		return nil, nil
+	case AuditSinkFile:
+		return NewFileAudit(c.File)
+	case AuditSinkRedis:
+		return NewRedisAudit(db, c), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", c.Sink)
+	}
+}
+
+// FileAudit is an audit log that appends
+// the entries to a file as JSON lines.
+type FileAudit struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	// size is the size of the file up to
+	// the end of the last entry written.
+	size int64
+}
+
+// NewFileAudit opens, or creates, the audit log file in path.
+func NewFileAudit(path string) (*FileAudit, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileAudit{path: path, f: f, size: info.Size()}, nil
+}
+
+// Record appends e to the file. If the write fails, the part of
+// the entry written is truncated, so the file only has whole entries.
+func (a *FileAudit) Record(ctx context.Context, e AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n, err := a.f.Write(append(line, '\n'))
+	if err == nil {
+		a.size += int64(n)
+		return nil
+	}
+	if n > 0 {
+		if terr := a.f.Truncate(a.size); terr != nil {
+			// The torn entry stays in the file,
+			// and it is skipped by Query.
+			a.size += int64(n)
+			return errors.Join(err, terr)
+		}
+	}
+	return err
+}
+
+// Query returns the newest entries in the file selected by q, up
+// to its limit, oldest first. The lines that are not a valid entry,
+// e.g. torn by a crash while writing them, are skipped.
+func (a *FileAudit) Query(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	if q.Limit <= 0 {
+		q.Limit = defAuditQueryMax
+	}
+
+	// Only the entries completely written when the query starts
+	// are read, so the file can be scanned without blocking Record.
+	a.mu.Lock()
+	size := a.size
+	a.mu.Unlock()
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(io.LimitReader(f, size))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || !q.matches(e) {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) > q.Limit {
+			entries = entries[1:]
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Close closes the audit log file.
+func (a *FileAudit) Close() error {
+	return a.f.Close()
+}
+
+// RedisAudit is an audit log that appends the entries to a Redis stream.
+type RedisAudit struct {
+	rdb    redis.UniversalClient
+	key    string
+	maxLen int64
+}
+
+// NewRedisAudit returns an audit log written to
+// the Redis stream configured in c.
+func NewRedisAudit(db *RedisDB, c AuditConfig) *RedisAudit {
+	key := c.Stream
+	if key == "" {
+		key = defAuditStream
+	}
+	return &RedisAudit{rdb: db.rdb, key: key, maxLen: c.MaxLen}
+}
+
+// Record appends e to the stream.
+func (a *RedisAudit) Record(ctx context.Context, e AuditEntry) (err error) {
+	defer func(start time.Time) { observeStorageOp("audit_record", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisAudit.Record", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return a.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: a.key,
+		MaxLen: a.maxLen,
+		Approx: a.maxLen > 0,
+		Values: map[string]interface{}{"entry": entry},
+	}).Err()
+}
+
+// Query returns the newest entries in the stream
+// selected by q, up to its limit, oldest first.
+func (a *RedisAudit) Query(ctx context.Context, q AuditQuery) (entries []AuditEntry, err error) {
+	defer func(start time.Time) { observeStorageOp("audit_query", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisAudit.Query", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	if q.Limit <= 0 {
+		q.Limit = defAuditQueryMax
+	}
+
+	// The IDs of the stream entries start with the
+	// time they were added, in milliseconds.
+	start, end := "-", "+"
+	if !q.Since.IsZero() {
+		start = strconv.FormatInt(q.Since.UnixMilli(), 10)
+	}
+
+	// The stream is read backwards, from the newest entry.
+	entries = []AuditEntry{}
+	for len(entries) < q.Limit {
+		msgs, err := a.rdb.XRevRangeN(ctx, a.key, end, start, auditPageSize).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			raw, _ := m.Values["entry"].(string)
+			var e AuditEntry
+			if err := json.Unmarshal([]byte(raw), &e); err != nil {
+				return nil, fmt.Errorf("invalid audit entry %s: %w", m.ID, err)
+			}
+			if q.matches(e) && len(entries) < q.Limit {
+				entries = append(entries, e)
+			}
+		}
+		if len(msgs) < auditPageSize {
+			break
+		}
+		end = "(" + msgs[len(msgs)-1].ID
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// WithAudit records the actions performed through the API in log.
+// The identity of the caller is read from identityHeader, if set.
+// It also exposes the audit entries at /audit.
+func WithAudit(log AuditLog, identityHeader string) APIOption {
+	return func(a *API) {
+		a.audit = log
+		a.identityHeader = identityHeader
+	}
+}
+
+// recordAudit writes an audit entry for the action performed by
+// the request r over the given checks, if the audit log is enabled.
+// A nil actionErr means the action succeeded.
+func (a *API) recordAudit(r *http.Request, action string, checks []string, scanID string, actionErr error) {
+	if a.audit == nil {
+		return
+	}
+	e := AuditEntry{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		SourceIP:  a.clientIP(r),
+		RequestID: requestIDFrom(r.Context()),
+		CheckIDs:  checks,
+		ScanID:    scanID,
+		Outcome:   auditOutcomeSuccess,
+	}
+	if a.identityHeader != "" {
+		e.Identity = r.Header.Get(a.identityHeader)
+	}
+	if actionErr != nil {
+		e.Outcome = auditOutcomeError
+		e.Error = actionErr.Error()
+	}
+	// The action has already been performed, so a failure
+	// to record it is logged but not returned to the caller.
+	ctx := context.WithoutCancel(r.Context())
+	if err := a.audit.Record(ctx, e); err != nil {
+		loggerFrom(ctx, a.logger).WithError(err).WithField("audit", e).Error("Unable to record audit entry")
+	}
+}
+
+// auditHandler returns the audit entries selected
+// by the check_id, since and limit query parameters.
+func (a *API) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	q := AuditQuery{CheckID: params.Get("check_id"), Limit: defAuditQueryMax}
+	if s := params.Get("since"); s != "" {
+		since, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			writeBadRequest(w, errors.New("since must be an RFC 3339 time"))
+			return
+		}
+		q.Since = since
+	}
+	if s := params.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > defAuditQueryMax {
+			writeBadRequest(w, fmt.Errorf("limit must be between 1 and %d", defAuditQueryMax))
+			return
+		}
+		q.Limit = limit
+	}
+
+	entries, err := a.audit.Query(r.Context(), q)
+	if err != nil {
+		a.writeErr(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func writeBadRequest(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(fmt.Sprintf("err: %v", err)))
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/adevinta/vulcan-metrics-client"
+	log "github.com/sirupsen/logrus"
+)
+
+type nopMetrics struct{}
+
+func (nopMetrics) Push(metrics.Metric)              {}
+func (nopMetrics) PushWithRate(metrics.RatedMetric) {}
+
+type abortStorage struct {
+	mockStorage
+	addErr error
+}
+
+func (s abortStorage) AddAbortedChecks(ctx context.Context, checks []string) error {
+	return s.addErr
+}
+
+func TestFileAuditQuery(t *testing.T) {
+	audit, err := NewFileAudit(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("expected no error opening audit log but got: %v", err)
+	}
+	defer audit.Close()
+
+	now := time.Now().UTC()
+	entries := []AuditEntry{
+		{Time: now.Add(-2 * time.Hour), Action: actionAbort, CheckIDs: []string{"c1"}, Outcome: auditOutcomeSuccess},
+		{Time: now.Add(-time.Hour), Action: actionAbort, CheckIDs: []string{"c1", "c2"}, Outcome: auditOutcomeSuccess},
+		{Time: now, Action: actionAbort, CheckIDs: []string{"c2"}, Outcome: auditOutcomeError},
+	}
+	for _, e := range entries {
+		if err := audit.Record(context.Background(), e); err != nil {
+			t.Fatalf("expected no error recording entry but got: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name  string
+		query AuditQuery
+		want  []AuditEntry
+	}{
+		{name: "All", query: AuditQuery{}, want: entries},
+		{name: "By check", query: AuditQuery{CheckID: "c1"}, want: entries[:2]},
+		{name: "Since", query: AuditQuery{Since: now.Add(-90 * time.Minute)}, want: entries[1:]},
+		{name: "By check since", query: AuditQuery{CheckID: "c1", Since: now.Add(-90 * time.Minute)}, want: entries[1:2]},
+		{name: "Limit", query: AuditQuery{Limit: 2}, want: entries[1:]},
+		{name: "By check limit", query: AuditQuery{CheckID: "c1", Limit: 1}, want: entries[1:2]},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := audit.Query(context.Background(), tc.query)
+			if err != nil {
+				t.Fatalf("expected no error querying audit log but got: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %d entries but got %d: %+v", len(tc.want), len(got), got)
+			}
+			for i := range got {
+				if !got[i].Time.Equal(tc.want[i].Time) {
+					t.Errorf("entry %d: expected entry recorded at %v but got %v", i, tc.want[i].Time, got[i].Time)
+				}
+			}
+		})
+	}
+}
+
+func TestFileAuditQueryTornEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// The first entry was torn by a crash while writing it.
+	if err := os.WriteFile(path, []byte(`{"time": "2026-01-02T03:04:05Z", "act`+"\n"), 0o600); err != nil {
+		t.Fatalf("expected no error writing audit log but got: %v", err)
+	}
+	audit, err := NewFileAudit(path)
+	if err != nil {
+		t.Fatalf("expected no error opening audit log but got: %v", err)
+	}
+	defer audit.Close()
+
+	e := AuditEntry{Time: time.Now().UTC(), Action: actionAbort, CheckIDs: []string{"c1"}, Outcome: auditOutcomeSuccess}
+	if err := audit.Record(context.Background(), e); err != nil {
+		t.Fatalf("expected no error recording entry but got: %v", err)
+	}
+	got, err := audit.Query(context.Background(), AuditQuery{})
+	if err != nil {
+		t.Fatalf("expected no error querying audit log but got: %v", err)
+	}
+	if len(got) != 1 || !got[0].Time.Equal(e.Time) {
+		t.Errorf("expected only the entry recorded but got %+v", got)
+	}
+}
+
+func TestAbortIsAudited(t *testing.T) {
+	testCases := []struct {
+		name        string
+		addErr      error
+		wantCode    int
+		wantOutcome string
+	}{
+		{name: "Success", wantCode: http.StatusOK, wantOutcome: auditOutcomeSuccess},
+		{name: "Storage error", addErr: errors.New("redis down"), wantCode: http.StatusInternalServerError, wantOutcome: auditOutcomeError},
+	}
+
+	logger := log.New()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			audit, err := NewFileAudit(filepath.Join(t.TempDir(), "audit.log"))
+			if err != nil {
+				t.Fatalf("expected no error opening audit log but got: %v", err)
+			}
+			defer audit.Close()
+
+			sender := NewSender(logger, SenderConfig{HTTPStream: "stream"})
+			api := NewAPI(0, sender, abortStorage{addErr: tc.addErr}, logger, nopMetrics{},
+				WithAudit(audit, "X-Forwarded-User"))
+
+			req := httptest.NewRequest(http.MethodPost, "/abort", strings.NewReader(`{"checks": ["c1"], "scan_id": "s1"}`))
+			req.Header.Set("X-Forwarded-User", "alice")
+			req.Header.Set(requestIDHeader, "req-1")
+			rec := httptest.NewRecorder()
+			api.mux.ServeHTTP(rec, req)
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected status code %d but got %d", tc.wantCode, rec.Code)
+			}
+
+			rec = httptest.NewRecorder()
+			api.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/audit?check_id=c1", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d", http.StatusOK, rec.Code)
+			}
+			var got []AuditEntry
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("expected no error decoding response but got: %v", err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected 1 audit entry but got %d", len(got))
+			}
+			e := got[0]
+			if e.Identity != "alice" || e.RequestID != "req-1" || e.ScanID != "s1" ||
+				e.SourceIP != "192.0.2.1" || e.Outcome != tc.wantOutcome {
+				t.Errorf("unexpected audit entry %+v", e)
+			}
+		})
+	}
+}
+
+func TestAuditHandlerBadRequest(t *testing.T) {
+	audit, err := NewFileAudit(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("expected no error opening audit log but got: %v", err)
+	}
+	defer audit.Close()
+
+	logger := log.New()
+	api := NewAPI(0, NewSender(logger, SenderConfig{}), mockStorage{}, logger, nil, WithAudit(audit, ""))
+
+	for _, query := range []string{"since=yesterday", "limit=0"} {
+		rec := httptest.NewRecorder()
+		api.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/audit?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d for %q but got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Event buses the messages can be mirrored to.
+const (
+	BridgeSinkKafka = "kafka"
+	BridgeSinkNATS  = "nats"
+	BridgeSinkRedis = "redis"
+)
+
+// Delivery guarantees of the bridge.
+const (
+	// BridgeAtMostOnce never delays the stream: the messages that
+	// don't fit in the queue or fail to be sent are dropped.
+	BridgeAtMostOnce = "at_most_once"
+	// BridgeAtLeastOnce retries the messages queued until they are
+	// sent. The messages that don't fit in the queue are still dropped,
+	// so the event bus never delays the stream.
+	BridgeAtLeastOnce = "at_least_once"
+)
+
+const (
+	// bridgeTopicPlaceholder is replaced by the
+	// stream topic in the bridge destination.
+	bridgeTopicPlaceholder = "{topic}"
+
+	// bridgeIDHeader is the Kafka and NATS header
+	// with the ID of the message.
+	bridgeIDHeader = "Vulcan-Message-Id"
+)
+
+// BridgeConfig defines the event bus the messages broadcast
+// to the stream are mirrored to.
+type BridgeConfig struct {
+	// Sink is the event bus: kafka, nats or redis, a Redis
+	// Stream in the storage. The bridge is disabled if empty.
+	Sink string
+	// Destination is the Kafka topic, NATS subject or Redis Stream
+	// the messages are sent to, where {topic} is replaced by the
+	// stream topic. Defaults to vulcan-stream.{topic}.
+	Destination string
+	// TopicMap overrides the destination of some stream topics,
+	// as topic=destination. The topics mapped to an empty
+	// destination are not mirrored.
+	TopicMap []string
+	// Delivery is the delivery guarantee: at_most_once,
+	// the default, or at_least_once.
+	Delivery string
+	// QueueSize is the number of messages queued
+	// to be sent. Defaults to 1000.
+	QueueSize int
+	// Backoff is the number of seconds before retrying a message with
+	// at_least_once delivery, doubled on every retry up to MaxBackoff.
+	// Defaults to 1 and 60.
+	Backoff    int
+	MaxBackoff int
+
+	// KafkaBrokers are the addresses of the Kafka brokers.
+	KafkaBrokers []string
+	// NATSURL is the URL of the NATS server. With at_least_once
+	// delivery the subjects must be captured by a JetStream stream.
+	NATSURL string
+	// RedisMaxLen is the approximate number of messages kept
+	// in each Redis Stream. Unlimited if zero.
+	RedisMaxLen int
+}
+
+// BridgeRecord is a message sent to the event bus.
+type BridgeRecord struct {
+	// Destination is the Kafka topic, NATS subject or Redis Stream.
+	Destination string
+	// ID is the ID of the message, so the consumers,
+	// or the event bus, can deduplicate it.
+	ID string
+	// Key is the check ID, or the agent ID, of the message. Kafka
+	// partitions by it, so the messages of a check keep their order.
+	Key string
+	// Data is the message, JSON encoded.
+	Data []byte
+}
+
+// Sink is an event bus the messages are mirrored to.
+type Sink interface {
+	// Send sends r, returning once the event bus has accepted it.
+	Send(ctx context.Context, r BridgeRecord) error
+	Close() error
+}
+
+// NewSink returns the event bus configured in c, or nil if the bridge
+// is disabled. The redis sink writes to the Redis Streams of db.
+func NewSink(c BridgeConfig, db *RedisDB) (Sink, error) {
+	switch c.Sink {
+	case "":
+		return nil, nil
+	case BridgeSinkKafka:
+		return newKafkaSink(c), nil
+	case BridgeSinkNATS:
+		return newNATSSink(c)
+	case BridgeSinkRedis:
+		return &redisSink{db: db, maxLen: int64(c.RedisMaxLen)}, nil
+	}
+	return nil, fmt.Errorf("unknown bridge sink %q", c.Sink)
+}
+
+// ParseTopicMap parses the topic=destination entries of
+// BridgeConfig.TopicMap.
+func ParseTopicMap(entries []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, e := range entries {
+		topic, dest, ok := strings.Cut(e, "=")
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("invalid topic mapping %q, expected topic=destination", e)
+		}
+		m[topic] = dest
+	}
+	return m, nil
+}
+
+// Bridge mirrors the messages broadcast to the stream to an event
+// bus. The messages are queued and sent in order by a single
+// goroutine, so a slow event bus does not delay the subscribers.
+type Bridge struct {
+	cfg        BridgeConfig
+	sink       Sink
+	topics     map[string]string
+	queue      chan BridgeRecord
+	done       chan struct{}
+	backoff    time.Duration
+	maxBackoff time.Duration
+	logger     logrus.FieldLogger
+
+	// mu guards closed, so no message is
+	// queued once the queue is closed.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBridge starts sending the messages mirrored to sink.
+func NewBridge(c BridgeConfig, sink Sink, logger logrus.FieldLogger) (*Bridge, error) {
+	b, err := newBridge(c, sink, logger)
+	if err != nil {
+		return nil, err
+	}
+	b.start()
+	return b, nil
+}
+
+func newBridge(c BridgeConfig, sink Sink, logger logrus.FieldLogger) (*Bridge, error) {
+	topics, err := ParseTopicMap(c.TopicMap)
+	if err != nil {
+		return nil, err
+	}
+	return &Bridge{
+		cfg:        c,
+		sink:       sink,
+		topics:     topics,
+		queue:      make(chan BridgeRecord, c.QueueSize),
+		done:       make(chan struct{}),
+		backoff:    time.Duration(c.Backoff) * time.Second,
+		maxBackoff: time.Duration(c.MaxBackoff) * time.Second,
+		logger:     logger.WithField("sink", c.Sink),
+	}, nil
+}
+
+// start starts the goroutine sending the queued messages.
+func (b *Bridge) start() {
+	go b.run()
+}
+
+// destination returns where the messages of topic are sent,
+// and false if they are not mirrored.
+func (b *Bridge) destination(topic string) (string, bool) {
+	if dest, ok := b.topics[topic]; ok {
+		return dest, dest != ""
+	}
+	return strings.ReplaceAll(b.cfg.Destination, bridgeTopicPlaceholder, topic), true
+}
+
+// Mirror queues msg, published to the given topic, to be sent to the
+// event bus. It never blocks: the message is dropped if the queue is
+// full. The pings are not mirrored. It's a no-op on a nil Bridge, and
+// the messages mirrored once the bridge is closed are dropped.
+func (b *Bridge) Mirror(topic string, msg Message) {
+	if b == nil || msg.Action == actionPing {
+		return
+	}
+	dest, ok := b.destination(topic)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		b.logger.WithError(err).Error("Error encoding mirrored message")
+		return
+	}
+	r := BridgeRecord{Destination: dest, ID: msg.ID, Key: msg.CheckID, Data: data}
+	if r.Key == "" {
+		r.Key = msg.AgentID
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		promBridged.WithLabelValues("dropped").Inc()
+		b.logger.WithField("message_id", r.ID).Warn("Bridge closed, message dropped")
+		return
+	}
+	select {
+	case b.queue <- r:
+	default:
+		promBridged.WithLabelValues("dropped").Inc()
+		b.logger.WithField("message_id", r.ID).Warn("Bridge queue full, message dropped")
+	}
+}
+
+// run sends the queued messages. With at_least_once delivery the
+// failed ones are retried, with exponential backoff, until sent.
+func (b *Bridge) run() {
+	defer close(b.done)
+	maxRetries := 0
+	if b.cfg.Delivery == BridgeAtLeastOnce {
+		maxRetries = -1
+	}
+	for r := range b.queue {
+		logger := b.logger.WithFields(logrus.Fields{
+			"message_id":  r.ID,
+			"destination": r.Destination,
+		})
+		_, err := retryBackoff(b.backoff, b.maxBackoff, maxRetries,
+			func() error { return b.sink.Send(context.Background(), r) },
+			func(attempt int, err error) {
+				promBridged.WithLabelValues("retried").Inc()
+				logger.WithError(err).WithField("attempt", attempt).Warn("Error sending message to the bridge, retrying")
+			},
+		)
+		if err != nil {
+			promBridged.WithLabelValues("dropped").Inc()
+			logger.WithError(err).Error("Error sending message to the bridge, message dropped")
+			continue
+		}
+		promBridged.WithLabelValues("sent").Inc()
+	}
+}
+
+// Close sends the messages already queued and closes the sink.
+// Closing the bridge again does nothing.
+func (b *Bridge) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+	<-b.done
+	return b.sink.Close()
+}
+
+// redisSink adds the messages to Redis Streams.
+type redisSink struct {
+	db     *RedisDB
+	maxLen int64
+}
+
+func (s *redisSink) Send(ctx context.Context, r BridgeRecord) error {
+	return s.db.AddToStream(ctx, r.Destination, s.maxLen, map[string]any{
+		"id":      r.ID,
+		"key":     r.Key,
+		"message": r.Data,
+	})
+}
+
+// Close does nothing, as the storage owns the connection.
+func (s *redisSink) Close() error {
+	return nil
+}
+
+// AddToStream adds an entry with the given values to a Redis
+// Stream, trimmed to about maxLen entries if maxLen is not zero.
+func (r *RedisDB) AddToStream(ctx context.Context, stream string, maxLen int64, values map[string]any) (err error) {
+	defer func(start time.Time) { observeStorageOp("add_to_stream", start, err) }(time.Now())
+	return r.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: maxLen > 0,
+		Values: values,
+	}).Err()
+}
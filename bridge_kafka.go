@@ -0,0 +1,44 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSink sends the messages to Kafka topics.
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+// newKafkaSink returns a sink waiting for the acknowledgement of the
+// partition leader, or of all the in-sync replicas with at_least_once
+// delivery. The messages are partitioned by key.
+func newKafkaSink(c BridgeConfig) *kafkaSink {
+	acks := kafka.RequireOne
+	if c.Delivery == BridgeAtLeastOnce {
+		acks = kafka.RequireAll
+	}
+	return &kafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(c.KafkaBrokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: acks,
+	}}
+}
+
+func (s *kafkaSink) Send(ctx context.Context, r BridgeRecord) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   r.Destination,
+		Key:     []byte(r.Key),
+		Value:   r.Data,
+		Headers: []kafka.Header{{Key: bridgeIDHeader, Value: []byte(r.ID)}},
+	})
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
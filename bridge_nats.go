@@ -0,0 +1,54 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsSink sends the messages to NATS subjects.
+type natsSink struct {
+	conn *nats.Conn
+	// js publishes the messages with at_least_once delivery,
+	// waiting for the stream to acknowledge them. It's nil with
+	// at_most_once delivery, which uses core NATS.
+	js jetstream.JetStream
+}
+
+func newNATSSink(c BridgeConfig) (*natsSink, error) {
+	conn, err := nats.Connect(c.NATSURL, nats.Name("vulcan-stream"))
+	if err != nil {
+		return nil, err
+	}
+	s := &natsSink{conn: conn}
+	if c.Delivery == BridgeAtLeastOnce {
+		if s.js, err = jetstream.New(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Send sets the message ID as the Nats-Msg-Id header, so JetStream
+// discards the messages sent again after a lost acknowledgement.
+func (s *natsSink) Send(ctx context.Context, r BridgeRecord) error {
+	msg := nats.NewMsg(r.Destination)
+	msg.Data = r.Data
+	msg.Header.Set(bridgeIDHeader, r.ID)
+	if s.js == nil {
+		return s.conn.PublishMsg(msg)
+	}
+	msg.Header.Set(jetstream.MsgIDHeader, r.ID)
+	_, err := s.js.PublishMsg(ctx, msg)
+	return err
+}
+
+func (s *natsSink) Close() error {
+	return s.conn.Drain()
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// memSink records the messages sent to it, failing the first fail sends.
+type memSink struct {
+	mu      sync.Mutex
+	fail    int
+	records []BridgeRecord
+	// block, if not nil, blocks the sends until closed.
+	block chan struct{}
+}
+
+func (s *memSink) Send(ctx context.Context, r BridgeRecord) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("event bus down")
+	}
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memSink) Close() error {
+	return nil
+}
+
+func TestBridge(t *testing.T) {
+	testCases := []struct {
+		name     string
+		delivery string
+		fail     int
+		want     []string
+	}{
+		{name: "At least once", delivery: BridgeAtLeastOnce, fail: 2, want: []string{"c1", "c2", "c3"}},
+		{name: "At most once", delivery: BridgeAtMostOnce, fail: 1, want: []string{"c2", "c3"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := log.New()
+			sink := &memSink{fail: tc.fail}
+			b, err := newBridge(BridgeConfig{
+				Destination: "vulcan-stream.{topic}",
+				Delivery:    tc.delivery,
+				TopicMap:    []string{"stream=vulcan.aborts", "internal="},
+				QueueSize:   10,
+			}, sink, logger)
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			b.backoff, b.maxBackoff = time.Millisecond, 2*time.Millisecond
+			b.start()
+
+			sender := NewSender(logger, SenderConfig{HTTPStream: "stream", Topics: []string{"reports", "internal"}})
+			sender.SetBridge(b)
+			ctx := context.Background()
+			sender.Broadcast(ctx, Message{Action: "abort", CheckID: "c1"})
+			// The pings are not mirrored.
+			sender.Broadcast(ctx, Message{Action: actionPing})
+			sender.Publish(ctx, "internal", Message{Action: "abort", CheckID: "c4"})
+			sender.Broadcast(ctx, Message{Action: "abort", CheckID: "c2"})
+			sender.Publish(ctx, "reports", Message{Action: "abort", CheckID: "c3"})
+			b.Close()
+
+			if len(sink.records) != len(tc.want) {
+				t.Fatalf("expected %d messages mirrored but got %+v", len(tc.want), sink.records)
+			}
+			for i, r := range sink.records {
+				var msg Message
+				if err := json.Unmarshal(r.Data, &msg); err != nil {
+					t.Fatalf("expected no error decoding message but got: %v", err)
+				}
+				if msg.CheckID != tc.want[i] || r.Key != msg.CheckID || r.ID == "" || r.ID != msg.ID {
+					t.Errorf("unexpected message %d mirrored %+v: %s", i, r, r.Data)
+				}
+				want := "vulcan.aborts"
+				if msg.CheckID == "c3" {
+					want = "vulcan-stream.reports"
+				}
+				if r.Destination != want {
+					t.Errorf("expected message %d sent to %s but got %s", i, want, r.Destination)
+				}
+			}
+		})
+	}
+}
+
+func TestBridgeQueueFull(t *testing.T) {
+	for _, delivery := range []string{BridgeAtMostOnce, BridgeAtLeastOnce} {
+		t.Run(delivery, func(t *testing.T) {
+			sink := &memSink{block: make(chan struct{})}
+			b, err := newBridge(BridgeConfig{
+				Destination: "vulcan-stream.{topic}",
+				Delivery:    delivery,
+				QueueSize:   1,
+			}, sink, log.New())
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			b.start()
+
+			// The first message is being sent, the second one queued
+			// and the rest dropped without blocking.
+			done := make(chan struct{})
+			go func() {
+				for range 5 {
+					b.Mirror("stream", Message{Action: "abort", CheckID: "c1"})
+				}
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected %s delivery not to block", delivery)
+			}
+			close(sink.block)
+			b.Close()
+			if len(sink.records) > 2 {
+				t.Errorf("expected at most 2 messages sent but got %d", len(sink.records))
+			}
+		})
+	}
+}
+
+func TestBridgeMirrorAfterClose(t *testing.T) {
+	sink := &memSink{}
+	b, err := NewBridge(BridgeConfig{
+		Destination: "vulcan-stream.{topic}",
+		Delivery:    BridgeAtLeastOnce,
+		QueueSize:   10,
+	}, sink, log.New())
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	b.Mirror("stream", Message{Action: "abort", CheckID: "c1"})
+	if err := b.Close(); err != nil {
+		t.Fatalf("expected no error closing the bridge but got: %v", err)
+	}
+
+	// The messages mirrored once closed are dropped.
+	b.Mirror("stream", Message{Action: "abort", CheckID: "c2"})
+	if err := b.Close(); err != nil {
+		t.Errorf("expected no error closing the bridge twice but got: %v", err)
+	}
+	if len(sink.records) != 1 {
+		t.Errorf("expected 1 message sent but got %d", len(sink.records))
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const requestTimeout = 30 * time.Second
+
+// client calls the stream API with the credentials of a profile.
+type client struct {
+	base   *url.URL
+	header http.Header
+	http   *http.Client
+	dialer *websocket.Dialer
+}
+
+// apiError is a response of the API with an unexpected status code.
+type apiError struct {
+	code int
+	body string
+}
+
+// newAPIError returns the apiError of resp, with
+// the beginning of its body as the message.
+func newAPIError(resp *http.Response) *apiError {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &apiError{code: resp.StatusCode, body: string(b)}
+}
+
+func (e *apiError) Error() string {
+	msg := strings.TrimSpace(e.body)
+	if msg == "" {
+		msg = http.StatusText(e.code)
+	}
+	return fmt.Sprintf("%d: %s", e.code, msg)
+}
+
+func newClient(p Profile) (*client, error) {
+	base, err := url.Parse(strings.TrimSuffix(p.URL, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q", p.URL)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.InsecureSkipVerify}
+	if p.CAFile != "" {
+		pem, err := os.ReadFile(p.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", p.CAFile)
+		}
+	}
+
+	header := http.Header{"User-Agent": {"vulcan-stream-ctl"}}
+	if p.Token != "" {
+		header.Set("Authorization", "Bearer "+p.Token)
+	}
+	if p.IdentityHeader != "" && p.Identity != "" {
+		header.Set(p.IdentityHeader, p.Identity)
+	}
+	return &client{
+		base:   base,
+		header: header,
+		http: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: requestTimeout,
+			TLSClientConfig:  tlsConfig,
+		},
+	}, nil
+}
+
+// send sends a request with in, if not nil, as the JSON body.
+func (c *client) send(ctx context.Context, method, path string, in any) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base.String()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.header.Clone()
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.http.Do(req)
+}
+
+// do sends a request and decodes the JSON response into out, if not
+// nil. The responses other than 2xx are returned as an apiError.
+func (c *client) do(ctx context.Context, method, path string, in, out any) error {
+	resp, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// dial connects to the websocket endpoint in path.
+func (c *client) dial(ctx context.Context, path string) (*websocket.Conn, error) {
+	u := *c.base
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path += path
+	conn, resp, err := c.dialer.DialContext(ctx, u.String(), c.header)
+	if err != nil && resp != nil {
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+	return conn, err
+}
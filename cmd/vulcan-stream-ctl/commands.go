@@ -0,0 +1,313 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	stream "github.com/adevinta/vulcan-stream"
+)
+
+// actionPing is the action of the keepalive messages
+// the stream broadcasts periodically.
+const actionPing = "ping"
+
+// newFlags returns the flag set of the named command,
+// whose usage shows the given arguments.
+func newFlags(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, strings.TrimSpace("Usage: vulcan-stream-ctl "+name+" "+synopsis))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args with fs and checks that at least min,
+// and at most max if not negative, arguments are left.
+func parseFlags(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// abortCmd aborts the checks, or schedules them to be aborted.
+func abortCmd(ctx context.Context, c *client, p *printer, args []string) error {
+	fs := newFlags("abort", "[flags] check-id...")
+	scanID := fs.String("scan-id", "", "`ID` of the scan the checks belong to")
+	topic := fs.String("topic", "", "`topic` the aborts are published to, instead of the default one")
+	at := fs.String("at", "", "RFC 3339 `time` to abort the checks at, instead of now")
+	in := fs.Duration("in", 0, "`delay` after which the checks are aborted, instead of now")
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+
+	req := stream.AbortRequest{Checks: fs.Args(), ScanID: *scanID, Topic: *topic}
+	switch {
+	case *at != "" && *in != 0:
+		return errors.New("-at and -in are mutually exclusive")
+	case *at != "":
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			return fmt.Errorf("invalid -at time: %w", err)
+		}
+		req.At = t
+	case *in != 0:
+		req.At = time.Now().Add(*in)
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, "/abort", req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return printChecks(p, req.Checks, true)
+	case http.StatusAccepted:
+		var s stream.ScheduledAbort
+		if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+			return err
+		}
+		return p.print(s, []string{"SCHEDULED ID", "AT", "CHECKS", "SCAN ID", "TOPIC"},
+			[][]string{{s.ID, formatTime(s.At), strings.Join(s.Checks, ","), orDash(s.ScanID), s.Topic}})
+	}
+	return newAPIError(resp)
+}
+
+// revokeCmd revokes the abort of the checks.
+func revokeCmd(ctx context.Context, c *client, p *printer, args []string) error {
+	fs := newFlags("revoke", "check-id...")
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	var revoked []string
+	for _, id := range fs.Args() {
+		if err := c.do(ctx, http.MethodDelete, "/checks/"+url.PathEscape(id), nil, nil); err != nil {
+			// Show the checks already revoked.
+			printChecks(p, revoked, false)
+			return fmt.Errorf("revoking %s: %w", id, err)
+		}
+		revoked = append(revoked, id)
+	}
+	return printChecks(p, revoked, false)
+}
+
+// printChecks prints the checks with the given abort status.
+func printChecks(p *printer, checks []string, aborted bool) error {
+	statuses := []stream.CheckStatus{}
+	for _, id := range checks {
+		statuses = append(statuses, stream.CheckStatus{CheckID: id, Aborted: aborted})
+	}
+	return printStatuses(p, statuses)
+}
+
+func printStatuses(p *printer, statuses []stream.CheckStatus) error {
+	var rows [][]string
+	for _, s := range statuses {
+		rows = append(rows, []string{s.CheckID, strconv.FormatBool(s.Aborted)})
+	}
+	return p.print(statuses, []string{"CHECK ID", "ABORTED"}, rows)
+}
+
+// listCmd lists the aborted checks.
+func listCmd(ctx context.Context, c *client, p *printer, args []string) error {
+	fs := newFlags("list", "")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	var checks []string
+	if err := c.do(ctx, http.MethodGet, "/checks", nil, &checks); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, id := range checks {
+		rows = append(rows, []string{id})
+	}
+	return p.print(checks, []string{"CHECK ID"}, rows)
+}
+
+// getCmd shows whether the checks are aborted.
+func getCmd(ctx context.Context, c *client, p *printer, args []string) error {
+	fs := newFlags("get", "check-id...")
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	var statuses []stream.CheckStatus
+	for _, id := range fs.Args() {
+		var s stream.CheckStatus
+		if err := c.do(ctx, http.MethodGet, "/checks/"+url.PathEscape(id), nil, &s); err != nil {
+			return fmt.Errorf("getting %s: %w", id, err)
+		}
+		statuses = append(statuses, s)
+	}
+	return printStatuses(p, statuses)
+}
+
+// agentsCmd lists the agents connected to the stream.
+func agentsCmd(ctx context.Context, c *client, p *printer, args []string) error {
+	fs := newFlags("agents", "")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	var agents []stream.Agent
+	if err := c.do(ctx, http.MethodGet, "/agents", nil, &agents); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, a := range agents {
+		rows = append(rows, []string{
+			orDash(a.AgentID),
+			a.RemoteAddr,
+			strings.Join(a.Topics, ","),
+			orDash(a.Subprotocol),
+			strconv.FormatBool(a.Compressed),
+			formatTime(a.ConnectedAt),
+		})
+	}
+	return p.print(agents, []string{"AGENT ID", "REMOTE ADDR", "TOPICS", "SUBPROTOCOL", "COMPRESSED", "CONNECTED AT"}, rows)
+}
+
+// statusCmd shows the readiness of the stream and its components.
+// It fails if the stream is not ready.
+func statusCmd(ctx context.Context, c *client, p *printer, args []string) error {
+	fs := newFlags("status", "")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/readyz", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return newAPIError(resp)
+	}
+	var h stream.HealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		return err
+	}
+
+	rows := [][]string{{"stream", h.Status, "-"}}
+	for _, name := range []string{"redis", "cache", "sender"} {
+		cs, ok := h.Components[name]
+		if !ok {
+			continue
+		}
+		var details []string
+		if cs.Size != nil {
+			details = append(details, fmt.Sprintf("size=%d", *cs.Size))
+		}
+		if cs.Pending != nil {
+			details = append(details, fmt.Sprintf("pending=%d", *cs.Pending))
+		}
+		if cs.LastSync != nil {
+			details = append(details, "last_sync="+cs.LastSync.Local().Format(time.RFC3339))
+		}
+		if cs.Error != "" {
+			details = append(details, "error="+cs.Error)
+		}
+		rows = append(rows, []string{name, cs.Status, orDash(strings.Join(details, " "))})
+	}
+	if err := p.print(h, []string{"COMPONENT", "STATUS", "DETAILS"}, rows); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("stream not ready")
+	}
+	return nil
+}
+
+// tailCmd prints the messages broadcast to a topic of the
+// stream, as they are received, until interrupted.
+func tailCmd(ctx context.Context, c *client, p *printer, args []string) error {
+	fs := newFlags("tail", "[flags]")
+	topic := fs.String("topic", "", "`topic` to follow, instead of the default one")
+	action := fs.String("action", "", "show only the messages with this `action`")
+	checkID := fs.String("check-id", "", "show only the messages of the check with this `ID`")
+	scanID := fs.String("scan-id", "", "show only the messages of the scan with this `ID`")
+	agentID := fs.String("agent-id", "", "show only the messages sent to the agent with this `ID`")
+	pings := fs.Bool("pings", false, "show the keepalive ping messages")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	path := "/stream"
+	if *topic != "" {
+		path += "/" + url.PathEscape(*topic)
+	}
+	conn, err := c.dial(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Unblock the read below once interrupted.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	filter := tailFilter{action: *action, checkID: *checkID, scanID: *scanID, agentID: *agentID, pings: *pings}
+
+	const line = "%-19s  %-12s  %-36s  %-36s  %s\n"
+	if p.format == formatTable {
+		fmt.Fprintf(p.w, line, "TIME", "ACTION", "CHECK ID", "SCAN ID", "AGENT ID")
+	}
+	enc := json.NewEncoder(p.w)
+	for {
+		var m stream.Message
+		if err := conn.ReadJSON(&m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("reading messages: %w", err)
+		}
+		if !filter.match(m) {
+			continue
+		}
+		if p.format == formatJSON {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(p.w, line, formatTime(m.CreatedAt), m.Action, orDash(m.CheckID), orDash(m.ScanID), orDash(m.AgentID))
+	}
+}
+
+// tailFilter selects the messages printed by tail.
+type tailFilter struct {
+	action  string
+	checkID string
+	scanID  string
+	agentID string
+	pings   bool
+}
+
+// match reports whether m is printed. The pings are only
+// printed with -pings, or when filtering by the ping action.
+func (f tailFilter) match(m stream.Message) bool {
+	return (f.pings || m.Action != actionPing || f.action == actionPing) &&
+		(f.action == "" || m.Action == f.action) &&
+		(f.checkID == "" || m.CheckID == f.checkID) &&
+		(f.scanID == "" || m.ScanID == f.scanID) &&
+		(f.agentID == "" || m.AgentID == f.agentID)
+}
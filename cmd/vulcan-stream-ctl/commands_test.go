@@ -0,0 +1,160 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/adevinta/vulcan-metrics-client"
+	stream "github.com/adevinta/vulcan-stream"
+	"github.com/alicebob/miniredis/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+type nopMetrics struct{}
+
+func (nopMetrics) Push(metrics.Metric)              {}
+func (nopMetrics) PushWithRate(metrics.RatedMetric) {}
+
+// newTestClient returns a client of a stream API
+// backed by an in-memory Redis.
+func newTestClient(t *testing.T) *client {
+	mr := miniredis.RunT(t)
+	port, _ := strconv.Atoi(mr.Port())
+	db, err := stream.NewRedisDB(stream.RedisConfig{Host: mr.Host(), Port: port})
+	if err != nil {
+		t.Fatalf("expected no error connecting to redis but got: %v", err)
+	}
+	logger := log.New()
+	storage, err := stream.NewStorage(db, stream.CacheConfig{}, logger)
+	if err != nil {
+		t.Fatalf("expected no error creating storage but got: %v", err)
+	}
+	sender := stream.NewSender(logger, stream.SenderConfig{HTTPStream: "stream"})
+	api := stream.NewAPI(0, sender, storage, logger, nopMetrics{}, stream.WithScheduler(db, time.Hour))
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	c, err := newClient(Profile{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("expected no error creating client but got: %v", err)
+	}
+	return c
+}
+
+func TestAbortCmd(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	var buf bytes.Buffer
+	p := &printer{w: &buf, format: formatJSON}
+
+	// Aborted now, with 200 OK.
+	if err := abortCmd(ctx, c, p, []string{"-scan-id", "s1", "c1", "c2"}); err != nil {
+		t.Fatalf("expected no error aborting checks but got: %v", err)
+	}
+	var statuses []stream.CheckStatus
+	if err := json.Unmarshal(buf.Bytes(), &statuses); err != nil {
+		t.Fatalf("expected no error decoding output but got: %v", err)
+	}
+	want := []stream.CheckStatus{{CheckID: "c1", Aborted: true}, {CheckID: "c2", Aborted: true}}
+	if len(statuses) != len(want) || statuses[0] != want[0] || statuses[1] != want[1] {
+		t.Errorf("expected checks %+v printed but got %+v", want, statuses)
+	}
+
+	buf.Reset()
+	if err := listCmd(ctx, c, p, nil); err != nil {
+		t.Fatalf("expected no error listing checks but got: %v", err)
+	}
+	var checks []string
+	if err := json.Unmarshal(buf.Bytes(), &checks); err != nil {
+		t.Fatalf("expected no error decoding output but got: %v", err)
+	}
+	if got := strings.Join(checks, ","); got != "c1,c2" {
+		t.Errorf("expected checks c1,c2 aborted but got %v", got)
+	}
+
+	// Scheduled, with 202 Accepted.
+	buf.Reset()
+	if err := abortCmd(ctx, c, p, []string{"-in", "1h", "c3"}); err != nil {
+		t.Fatalf("expected no error scheduling abort but got: %v", err)
+	}
+	var s stream.ScheduledAbort
+	if err := json.Unmarshal(buf.Bytes(), &s); err != nil {
+		t.Fatalf("expected no error decoding output but got: %v", err)
+	}
+	if s.ID == "" || strings.Join(s.Checks, ",") != "c3" || s.Topic != "stream" || time.Until(s.At) < 59*time.Minute {
+		t.Errorf("unexpected scheduled abort printed %+v", s)
+	}
+
+	// Rejected.
+	err := abortCmd(ctx, c, p, []string{"-topic", "unknown", "c4"})
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.code != http.StatusBadRequest {
+		t.Errorf("expected a 400 API error but got: %v", err)
+	}
+	if err := abortCmd(ctx, c, p, []string{"-at", "2026-01-01T00:00:00Z", "-in", "1h", "c4"}); err == nil {
+		t.Error("expected error with both -at and -in")
+	}
+}
+
+func TestAbortCmdTable(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	var buf bytes.Buffer
+	p := &printer{w: &buf, format: formatTable}
+
+	if err := abortCmd(ctx, c, p, []string{"c1"}); err != nil {
+		t.Fatalf("expected no error aborting checks but got: %v", err)
+	}
+	if want := "CHECK ID  ABORTED\nc1        true\n"; buf.String() != want {
+		t.Errorf("expected output:\n%s\nbut got:\n%s", want, buf.String())
+	}
+
+	buf.Reset()
+	if err := revokeCmd(ctx, c, p, []string{"c1"}); err != nil {
+		t.Fatalf("expected no error revoking checks but got: %v", err)
+	}
+	if want := "CHECK ID  ABORTED\nc1        false\n"; buf.String() != want {
+		t.Errorf("expected output:\n%s\nbut got:\n%s", want, buf.String())
+	}
+}
+
+func TestTailFilter(t *testing.T) {
+	ping := stream.Message{Action: actionPing}
+	abort := stream.Message{Action: "abort", CheckID: "c1", ScanID: "s1"}
+	drain := stream.Message{Action: "drain", AgentID: "a1"}
+
+	testCases := []struct {
+		name   string
+		filter tailFilter
+		want   []bool // ping, abort, drain
+	}{
+		{name: "None", filter: tailFilter{}, want: []bool{false, true, true}},
+		{name: "Pings", filter: tailFilter{pings: true}, want: []bool{true, true, true}},
+		{name: "Ping action", filter: tailFilter{action: actionPing}, want: []bool{true, false, false}},
+		{name: "Action", filter: tailFilter{action: "abort", pings: true}, want: []bool{false, true, false}},
+		{name: "Check", filter: tailFilter{checkID: "c1"}, want: []bool{false, true, false}},
+		{name: "Scan", filter: tailFilter{scanID: "s2"}, want: []bool{false, false, false}},
+		{name: "Agent", filter: tailFilter{agentID: "a1"}, want: []bool{false, false, true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, m := range []stream.Message{ping, abort, drain} {
+				if got := tc.filter.match(m); got != tc.want[i] {
+					t.Errorf("expected %s message matched %v but got %v", m.Action, tc.want[i], got)
+				}
+			}
+		})
+	}
+}
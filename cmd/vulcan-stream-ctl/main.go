@@ -0,0 +1,117 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+// Command vulcan-stream-ctl manages a Vulcan Stream: it aborts checks,
+// revokes aborts, inspects the aborted checks and the connected agents
+// and follows the messages broadcast to the agents.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: vulcan-stream-ctl [flags] <command> [command flags] [args]
+
+Commands:
+  abort    Abort checks, now or at a given time
+  revoke   Revoke the abort of checks
+  list     List the aborted checks
+  get      Show whether a check is aborted
+  tail     Follow the messages broadcast to the agents
+  agents   List the agents connected to the stream
+  status   Show the readiness of the stream
+
+Run vulcan-stream-ctl <command> -h for the flags of a command.
+
+Flags:
+`
+
+// errUsage is returned by the commands called with invalid
+// arguments, once they have printed their usage.
+var errUsage = errors.New("invalid usage")
+
+// command runs a command with its arguments.
+type command func(ctx context.Context, c *client, p *printer, args []string) error
+
+var commands = map[string]command{
+	"abort":  abortCmd,
+	"revoke": revokeCmd,
+	"list":   listCmd,
+	"get":    getCmd,
+	"tail":   tailCmd,
+	"agents": agentsCmd,
+	"status": statusCmd,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command in args and returns the exit code.
+func run(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("vulcan-stream-ctl", flag.ContinueOnError)
+	profilesFile := fs.String("profiles", defaultProfilesFile(), "`file` with the stream profiles")
+	profile := fs.String("profile", os.Getenv("VULCAN_STREAM_PROFILE"), "`name` of the profile, instead of the default one")
+	endpoint := fs.String("url", os.Getenv("VULCAN_STREAM_URL"), "`URL` of the stream, overriding the one of the profile")
+	format := fs.String("o", formatTable, "output `format`: table or json")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	if *format != formatTable && *format != formatJSON {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *format)
+		return 2
+	}
+
+	p, err := loadProfile(*profilesFile, *profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *endpoint != "" {
+		p.URL = *endpoint
+	}
+	c, err := newClient(p)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	err = cmd(ctx, c, &printer{w: os.Stdout, format: *format}, fs.Args()[1:])
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPrinter(t *testing.T) {
+	v := []struct {
+		CheckID string `json:"check_id"`
+	}{{CheckID: "c1"}, {CheckID: "c2"}}
+	header := []string{"CHECK ID", "SCAN ID"}
+	rows := [][]string{{"c1", "s1"}, {"c2", orDash("")}}
+
+	testCases := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: formatTable,
+			want:   "CHECK ID  SCAN ID\nc1        s1\nc2        -\n",
+		},
+		{
+			format: formatJSON,
+			want:   "[\n  {\n    \"check_id\": \"c1\"\n  },\n  {\n    \"check_id\": \"c2\"\n  }\n]\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			p := &printer{w: &buf, format: tc.format}
+			if err := p.print(v, header, rows); err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("expected output:\n%s\nbut got:\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	if got := formatTime(time.Time{}); got != "-" {
+		t.Errorf("expected zero time formatted as - but got %q", got)
+	}
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	if got, want := formatTime(at.UTC()), "2026-01-02 03:04:05"; got != want {
+		t.Errorf("expected time formatted as %q but got %q", want, got)
+	}
+}
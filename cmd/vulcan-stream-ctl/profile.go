@@ -0,0 +1,94 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// defURL is the stream used when there is no profile.
+const defURL = "http://localhost:8080"
+
+// Profile defines a stream the commands are run against
+// and the credentials used to reach it.
+type Profile struct {
+	// URL is the base URL of the stream API.
+	URL string
+	// Token is sent as a bearer token, e.g. to the authenticating
+	// proxy in front of the stream. TokenEnv is the environment
+	// variable the token is read from, instead.
+	Token    string
+	TokenEnv string
+	// IdentityHeader is the header the Identity of the operator is
+	// sent in, e.g. the Audit.IdentityHeader of the stream.
+	IdentityHeader string
+	Identity       string
+	// CAFile is the PEM file with the CAs used to verify the
+	// certificate of the stream. If empty, the system CAs are used.
+	CAFile             string
+	InsecureSkipVerify bool
+}
+
+// profiles is the content of the profiles file.
+type profiles struct {
+	// Default is the profile used when none is given.
+	Default string
+	Profile map[string]Profile
+}
+
+// defaultProfilesFile returns the path of the profiles file in
+// the user config directory, or an empty path if it is unknown.
+func defaultProfilesFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "vulcan-stream", "profiles.toml")
+}
+
+// loadProfile returns the profile with the given name, or the default
+// one if name is empty, from the profiles file in path. If there is no
+// profiles file and no name is given, a profile for a local stream is
+// returned.
+func loadProfile(path, name string) (Profile, error) {
+	var ps profiles
+	md, err := toml.DecodeFile(path, &ps)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && name == "":
+		return Profile{URL: defURL}, nil
+	case err != nil:
+		return Profile{}, fmt.Errorf("reading profiles: %w", err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return Profile{}, fmt.Errorf("unknown keys in %s: %v", path, undecoded)
+	}
+
+	if name == "" {
+		name = ps.Default
+	}
+	if name == "" {
+		return Profile{}, fmt.Errorf("no profile given and no Default profile in %s", path)
+	}
+	p, ok := ps.Profile[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q in %s", name, path)
+	}
+	if p.URL == "" {
+		return Profile{}, fmt.Errorf("profile %q: URL is required", name)
+	}
+	if p.TokenEnv != "" {
+		p.Token = os.Getenv(p.TokenEnv)
+		if p.Token == "" {
+			return Profile{}, fmt.Errorf("profile %q: environment variable %s is not set", name, p.TokenEnv)
+		}
+	}
+	return p, nil
+}
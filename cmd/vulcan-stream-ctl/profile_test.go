@@ -0,0 +1,106 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testProfiles = `
+Default = "prod"
+
+[Profile.prod]
+URL = "https://stream.example.com"
+TokenEnv = "TEST_STREAM_TOKEN"
+IdentityHeader = "X-Identity"
+Identity = "alice"
+
+[Profile.dev]
+URL = "http://localhost:8080"
+Token = "dev-token"
+
+[Profile.nourl]
+Token = "token"
+
+[Profile.noenv]
+URL = "https://stream.example.com"
+TokenEnv = "TEST_STREAM_UNSET"
+`
+
+func TestLoadProfile(t *testing.T) {
+	t.Setenv("TEST_STREAM_TOKEN", "prod-token")
+
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("expected no error writing profiles but got: %v", err)
+		}
+		return path
+	}
+	profilesFile := write("profiles.toml", testProfiles)
+	noDefault := write("nodefault.toml", `[Profile.dev]
+URL = "http://localhost:8080"
+`)
+	unknownKeys := write("unknown.toml", `[Profile.dev]
+URL = "http://localhost:8080"
+Tokn = "token"
+`)
+	missing := filepath.Join(dir, "missing.toml")
+
+	testCases := []struct {
+		name    string
+		path    string
+		profile string
+		want    Profile
+		wantErr string
+	}{
+		{
+			name: "Default",
+			path: profilesFile,
+			want: Profile{
+				URL:            "https://stream.example.com",
+				Token:          "prod-token",
+				TokenEnv:       "TEST_STREAM_TOKEN",
+				IdentityHeader: "X-Identity",
+				Identity:       "alice",
+			},
+		},
+		{
+			name:    "Named",
+			path:    profilesFile,
+			profile: "dev",
+			want:    Profile{URL: "http://localhost:8080", Token: "dev-token"},
+		},
+		{name: "Unknown profile", path: profilesFile, profile: "staging", wantErr: `unknown profile "staging"`},
+		{name: "Without URL", path: profilesFile, profile: "nourl", wantErr: "URL is required"},
+		{name: "TokenEnv not set", path: profilesFile, profile: "noenv", wantErr: "TEST_STREAM_UNSET is not set"},
+		{name: "Without Default", path: noDefault, wantErr: "no Default profile"},
+		{name: "Unknown keys", path: unknownKeys, profile: "dev", wantErr: "unknown keys"},
+		{name: "Without file", path: missing, want: Profile{URL: defURL}},
+		{name: "Without file named", path: missing, profile: "dev", wantErr: "reading profiles"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := loadProfile(tc.path, tc.profile)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q but got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected profile %+v but got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adevinta/vulcan-stream/config"
+)
+
+const configUsage = `Usage: vulcan-stream config <command> [flags] [config-file]
+
+Commands:
+  print  Print the effective configuration with secrets redacted
+`
+
+// configCmd runs the config subcommands and returns the exit code.
+func configCmd(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "print":
+		cfg, err := config.Load("vulcan-stream config print", args[1:], os.Environ(), os.Stderr)
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+			return 1
+		}
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "error printing configuration: %v\n", err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config command %q\n\n%s", args[0], configUsage)
+		return 2
+	}
+}
+
+// validateCmd validates the config file given in args, without taking
+// into account the environment, and returns the exit code.
+func validateCmd(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: vulcan-stream validate config-file")
+		return 2
+	}
+
+	if _, err := config.ReadConfig(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s is not valid:\n%v\n", args[0], err)
+		return 1
+	}
+	fmt.Printf("%s is valid\n", args[0])
+	return 0
+}
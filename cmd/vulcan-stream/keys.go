@@ -0,0 +1,49 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	stream "github.com/adevinta/vulcan-stream"
+)
+
+// keygenCmd generates an Ed25519 signing key, writing the private key
+// to the file given in args and the public key to the same file with
+// the .pub suffix, and returns the exit code.
+func keygenCmd(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: vulcan-stream keygen private-key-file")
+		return 2
+	}
+
+	private, public, err := stream.GenerateKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error generating key: %v\n", err)
+		return 1
+	}
+	path := args[0]
+	// Don't overwrite an existing key by mistake.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing private key: %v\n", err)
+		return 1
+	}
+	_, err = f.Write(private)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing private key: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(path+".pub", public, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing public key: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Private key written to %s and public key to %s.pub\n", path, path)
+	return 0
+}
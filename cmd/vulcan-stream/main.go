@@ -5,22 +5,42 @@ Copyright 2019 Adevinta
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	metrics "github.com/adevinta/vulcan-metrics-client"
 	stream "github.com/adevinta/vulcan-stream"
 	"github.com/adevinta/vulcan-stream/config"
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		log.Fatal("Usage: vulcan-stream config-file")
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "config":
+			os.Exit(configCmd(args[1:]))
+		case "validate":
+			os.Exit(validateCmd(args[1:]))
+		case "keygen":
+			os.Exit(keygenCmd(args[1:]))
+		}
 	}
-	configFile := os.Args[1]
 
-	// Read config file.
-	config := config.MustReadConfig(configFile)
+	// Load config from defaults, file, env and flags.
+	config, err := config.Load("vulcan-stream", args, os.Environ(), os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
 
 	// Initialize logger.
 	logger, logFile, err := stream.NewLogger(config.Logger)
@@ -31,22 +51,131 @@ func main() {
 		// We don't care about the error because a log file may not even exist.
 		_ = logFile.Close()
 	}()
+	reopenOnSignal(logFile, logger)
 
 	// Build metrics client.
-	metrics, err := metrics.NewClient()
+	var metricsClient metrics.Client = nopMetrics{}
+	if config.Metrics.Enabled {
+		metricsClient, err = metrics.NewClient()
+		if err != nil {
+			log.Fatalf("unable to build metrics client: %v", err)
+		}
+	}
+
+	// Set up tracing.
+	shutdownTracing, err := stream.NewTracing(context.Background(), config.Tracing)
 	if err != nil {
-		log.Fatalf("unable to build metrics client: %v", err)
+		log.Fatalf("unable to set up tracing: %v", err)
 	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
 
 	logger.Info("Starting Vulcan Stream")
 
 	sender := stream.NewSender(logger, config.Sender)
+	keyring, err := stream.LoadKeyring(config.Sender)
+	if err != nil {
+		logger.WithError(err).Panic("Unable to load the message signing keys")
+	}
+	sender.SetKeyring(keyring)
+
+	redisDB, err := stream.NewRedisDB(config.Storage)
+	if err != nil {
+		logger.WithError(err).Panic()
+	}
+
+	sink, err := stream.NewSink(config.Bridge, redisDB)
+	if err != nil {
+		logger.WithError(err).Panic("Unable to connect to the bridge sink")
+	}
+	if sink != nil {
+		bridge, err := stream.NewBridge(config.Bridge, sink, logger)
+		if err != nil {
+			logger.WithError(err).Panic("Unable to set up the bridge")
+		}
+		defer bridge.Close()
+		sender.SetBridge(bridge)
+	}
+
+	storage, err := stream.NewStorage(redisDB, config.Cache, logger)
+	if err != nil {
+		logger.WithError(err).Panic()
+	}
+
+	// Reload the configuration on SIGHUP and config file changes.
+	r := &reloader{
+		args:    args,
+		current: config,
+		logger:  logger,
+		sender:  sender,
+		redisDB: redisDB,
+	}
+	r.watch()
 
-	storage, err := stream.NewStorage(stream.NewRedisDB(config.Storage), logger)
+	opts := []stream.APIOption{
+		stream.WithCacheMaxAge(time.Duration(config.API.CacheMaxAge) * time.Hour),
+		stream.WithActions(config.API.Actions),
+		stream.WithScheduler(redisDB, time.Duration(config.API.ScheduleInterval)*time.Second),
+	}
+	opts = append(opts, stream.WithRateLimit(config.RateLimit))
+	auditLog, err := stream.NewAuditLog(config.Audit, redisDB)
 	if err != nil {
 		logger.WithError(err).Panic()
 	}
+	if auditLog != nil {
+		opts = append(opts, stream.WithAudit(auditLog, config.Audit.IdentityHeader))
+	}
+	if config.Webhooks.File != "" {
+		hooks, err := stream.LoadWebhooks(config.Webhooks.File)
+		if err != nil {
+			logger.WithError(err).Panic("Unable to load the webhooks")
+		}
+		dead := stream.NewRedisDeadLetters(redisDB, config.Webhooks)
+		opts = append(opts, stream.WithWebhooks(stream.NewWebhooks(config.Webhooks, hooks, dead, logger)))
+	}
+	source, err := stream.NewSource(context.Background(), config.Ingest)
+	if err != nil {
+		logger.WithError(err).Panic("Unable to connect to the ingest source")
+	}
+	if source != nil {
+		ttl := time.Duration(config.Ingest.DedupTTL) * time.Hour
+		opts = append(opts, stream.WithIngestion(source, config.Ingest.Source, redisDB, ttl))
+	}
+	if config.Metrics.Prometheus {
+		opts = append(opts, stream.WithPrometheus(config.Metrics.PrometheusPath))
+	}
 
-	api := stream.NewAPI(config.API.Port, sender, storage, logger, metrics)
-	api.Start()
+	// Stop on SIGINT and SIGTERM, so the ingestion and
+	// the bridge are closed before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	api := stream.NewAPI(config.API.Port, sender, storage, logger, metricsClient, opts...)
+	api.Start(ctx)
 }
+
+// reopenOnSignal reopens the log file on SIGUSR1,
+// so it can be rotated by external tools like logrotate.
+func reopenOnSignal(f *stream.LogFile, logger logrus.FieldLogger) {
+	if f == nil {
+		return
+	}
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			if err := f.Reopen(); err != nil {
+				logger.WithError(err).Error("Unable to reopen log file")
+				continue
+			}
+			logger.Info("SIGUSR1 received, log file reopened")
+		}
+	}()
+}
+
+// nopMetrics is a metrics client that discards every metric.
+// It is used when pushing metrics to DogStatsD is disabled.
+type nopMetrics struct{}
+
+func (nopMetrics) Push(metrics.Metric)              {}
+func (nopMetrics) PushWithRate(metrics.RatedMetric) {}
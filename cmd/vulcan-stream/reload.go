@@ -0,0 +1,134 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	stream "github.com/adevinta/vulcan-stream"
+	"github.com/adevinta/vulcan-stream/config"
+	"github.com/sirupsen/logrus"
+)
+
+// watchInterval is how often the config file is checked for changes.
+const watchInterval = 10 * time.Second
+
+// reloader reloads the configuration on SIGHUP and when the
+// config file changes, applying the changes that are safe to
+// apply without restarting.
+type reloader struct {
+	sync.Mutex
+	args    []string
+	current config.Config
+	logger  logrus.FieldLogger
+	sender  *stream.Sender
+	redisDB *stream.RedisDB
+}
+
+// watch starts reloading the configuration
+// on SIGHUP and on config file changes.
+func (r *reloader) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			r.logger.Info("SIGHUP received, reloading configuration")
+			r.reload()
+		}
+	}()
+
+	if path := config.FileArg(r.args); path != "" {
+		go r.watchFile(path)
+	}
+}
+
+// watchFile reloads the configuration when the file in path changes.
+func (r *reloader) watchFile(path string) {
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		fi, err := os.Stat(path)
+		if err != nil {
+			r.logger.WithError(err).Warn("Unable to stat config file")
+			continue
+		}
+		if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+			continue
+		}
+		last = fi
+		r.logger.Info("Config file changed, reloading configuration")
+		r.reload()
+	}
+}
+
+// reload loads the configuration and applies the changes that can be
+// applied live. The changes that require a restart are logged.
+func (r *reloader) reload() {
+	r.Lock()
+	defer r.Unlock()
+
+	cfg, err := config.Load("vulcan-stream", r.args, os.Environ(), io.Discard)
+	if err != nil {
+		r.logger.WithError(err).Error("Invalid configuration, keeping the current one")
+		return
+	}
+
+	var applied, restart []string
+	for _, key := range config.Changed(r.current, cfg) {
+		switch key {
+		case "Logger.LogLevel":
+			if err := stream.SetLogLevel(r.logger, cfg.Logger.LogLevel); err != nil {
+				r.logger.WithError(err).Error("Unable to change log level")
+				continue
+			}
+			r.current.Logger.LogLevel = cfg.Logger.LogLevel
+		case "Sender.PingInterval":
+			r.sender.SetPingInterval(cfg.Sender.PingInterval * time.Second)
+			r.current.Sender.PingInterval = cfg.Sender.PingInterval
+		case "Storage.TTL":
+			r.redisDB.SetTTL(cfg.Storage.TTL)
+			r.current.Storage.TTL = cfg.Storage.TTL
+		case "Sender.SigningKeyFile", "Sender.PublicKeyFiles":
+			// Applied below, along with the changes in the key files.
+			continue
+		default:
+			restart = append(restart, key)
+			continue
+		}
+		applied = append(applied, key)
+	}
+
+	// The key files can change without changing the
+	// configuration, so the keys are always reloaded.
+	if err := r.reloadKeys(cfg.Sender); err != nil {
+		r.logger.WithError(err).Error("Unable to reload the message signing keys, keeping the current ones")
+	}
+
+	if len(applied) > 0 {
+		r.logger.WithField("fields", applied).Info("Configuration changes applied")
+	}
+	if len(restart) > 0 {
+		r.logger.WithField("fields", restart).Warn("Configuration changes require a restart to be applied")
+	}
+}
+
+// reloadKeys loads the message signing keys configured in c and
+// makes the sender use them.
+func (r *reloader) reloadKeys(c stream.SenderConfig) error {
+	keyring, err := stream.LoadKeyring(c)
+	if err != nil {
+		return err
+	}
+	r.sender.SetKeyring(keyring)
+	r.current.Sender.SigningKeyFile = c.SigningKeyFile
+	r.current.Sender.PublicKeyFiles = c.PublicKeyFiles
+	return nil
+}
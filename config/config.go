@@ -6,30 +6,101 @@ package config
 
 import (
 	"log"
-	"os"
 
-	"github.com/BurntSushi/toml"
 	stream "github.com/adevinta/vulcan-stream"
 )
 
 // Config defines required configuration for VulcanStream
 type Config struct {
-	Logger  stream.LoggerConfig `toml:"Logger"`
-	Sender  stream.SenderConfig `toml:"Sender"`
-	API     stream.APIConfig    `toml:"API"`
-	Storage stream.RedisConfig  `toml:"Storage"`
+	Logger    stream.LoggerConfig    `toml:"Logger"`
+	Sender    stream.SenderConfig    `toml:"Sender"`
+	API       stream.APIConfig       `toml:"API"`
+	Storage   stream.RedisConfig     `toml:"Storage"`
+	Cache     stream.CacheConfig     `toml:"Cache"`
+	Metrics   stream.MetricsConfig   `toml:"Metrics"`
+	Tracing   stream.TracingConfig   `toml:"Tracing"`
+	Audit     stream.AuditConfig     `toml:"Audit"`
+	RateLimit stream.RateLimitConfig `toml:"RateLimit"`
+	Webhooks  stream.WebhooksConfig  `toml:"Webhooks"`
+	Ingest    stream.IngestConfig    `toml:"Ingest"`
+	Bridge    stream.BridgeConfig    `toml:"Bridge"`
 }
 
-// MustReadConfig reads TOML file with Vulcan Stream configuration
-func MustReadConfig(path string) Config {
-	configData, err := os.ReadFile(path)
+// Defaults returns the default configuration.
+func Defaults() Config {
+	return Config{
+		Logger: stream.LoggerConfig{
+			LogLevel: "INFO",
+			Format:   stream.LogFormatText,
+		},
+		Sender: stream.SenderConfig{
+			HTTPStream:     "stream",
+			PingInterval:   10,
+			QueueSize:      64,
+			OverflowPolicy: stream.OverflowDropOldest,
+			WriteTimeout:   10,
+
+			CompressionLevel:     1,
+			CompressionThreshold: 1024,
+		},
+		API: stream.APIConfig{
+			Port:             8080,
+			Actions:          []string{"abort"},
+			ScheduleInterval: 1,
+		},
+		Storage: stream.RedisConfig{
+			Host: "127.0.0.1",
+			Port: 6379,
+		},
+		Tracing: stream.TracingConfig{
+			SampleRatio: 1,
+		},
+		Webhooks: stream.WebhooksConfig{
+			MaxRetries:     5,
+			Backoff:        1,
+			MaxBackoff:     60,
+			Timeout:        10,
+			QueueSize:      1000,
+			DeadLetterKey:  "vulcan-stream:webhooks:dead",
+			MaxDeadLetters: 1000,
+		},
+		Ingest: stream.IngestConfig{
+			DedupTTL: 24,
+		},
+		Bridge: stream.BridgeConfig{
+			Destination: "vulcan-stream.{topic}",
+			Delivery:    stream.BridgeAtMostOnce,
+			QueueSize:   1000,
+			Backoff:     1,
+			MaxBackoff:  60,
+		},
+	}
+}
+
+// ReadConfig reads TOML file with Vulcan Stream configuration on top of
+// the defaults. Unknown keys in the file and invalid values are returned
+// as an Errors value.
+func ReadConfig(path string) (Config, error) {
+	config := Defaults()
+	errs, err := decodeFile(path, &config)
 	if err != nil {
-		log.Fatalf("Cannot read configuration file (%v)", err)
+		return Config{}, err
+	}
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err.(Errors)...)
 	}
+	if len(errs) > 0 {
+		return Config{}, errs
+	}
+
+	return config, nil
+}
 
-	var config Config
-	if _, err := toml.Decode(string(configData), &config); err != nil {
-		log.Fatalf("Cannot decode configuration file (%v)", err)
+// MustReadConfig reads TOML file with Vulcan Stream configuration
+func MustReadConfig(path string) Config {
+	config, err := ReadConfig(path)
+	if err != nil {
+		log.Fatalf("Invalid configuration file %s:\n%v", path, err)
 	}
 
 	return config
@@ -20,6 +20,9 @@ const (
 	// Sender
 	httpStream   = "stream"
 	pingInterval = 5
+	// Metrics
+	metricsEnabled = false
+	prometheus     = true
 )
 
 func TestMustReadConfig(t *testing.T) {
@@ -50,4 +53,11 @@ func TestMustReadConfig(t *testing.T) {
 	if cfg.Sender.PingInterval != pingInterval {
 		t.Errorf("Test failed, expected: '%d', got:  '%d'", pingInterval, cfg.Sender.PingInterval)
 	}
+	// Metrics
+	if cfg.Metrics.Enabled != metricsEnabled {
+		t.Errorf("Test failed, expected: '%t', got:  '%t'", metricsEnabled, cfg.Metrics.Enabled)
+	}
+	if cfg.Metrics.Prometheus != prometheus {
+		t.Errorf("Test failed, expected: '%t', got:  '%t'", prometheus, cfg.Metrics.Prometheus)
+	}
 }
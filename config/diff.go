@@ -0,0 +1,21 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package config
+
+// Changed returns the TOML paths, e.g. Sender.PingInterval,
+// of the fields that have different values in a and b.
+func Changed(a, b Config) []string {
+	fa, fb := configFields(&a), configFields(&b)
+
+	var keys []string
+	for i := range fa {
+		// Compare the TOML representations, so nil and
+		// empty lists are considered equal.
+		if fa[i].String() != fb[i].String() {
+			keys = append(keys, fa[i].key())
+		}
+	}
+	return keys
+}
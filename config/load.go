@@ -0,0 +1,327 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// EnvPrefix is the prefix of the environment variables
+// that override the configuration.
+const EnvPrefix = "VULCAN_STREAM_"
+
+// Errors is a list of configuration errors.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Load builds the configuration by layering, from lowest to highest
+// precedence, the defaults, the TOML file given as the only positional
+// argument in args (if any), the VULCAN_STREAM_* variables in environ
+// and the flags in args.
+//
+// Every configuration key can be set with an environment variable named
+// after its TOML path, e.g. VULCAN_STREAM_SENDER_PINGINTERVAL, and with a
+// flag named after its lowercased TOML path, e.g. -sender.pinginterval.
+// Lists are given as comma separated values.
+func Load(name string, args []string, environ []string, output io.Writer) (Config, error) {
+	c := Defaults()
+	fields := configFields(&c)
+
+	fs, flags := newFlagSet(name, fields, output)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	var errs Errors
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		undecoded, err := decodeFile(fs.Arg(0), &c)
+		if err != nil {
+			return Config{}, err
+		}
+		errs = append(errs, undecoded...)
+	default:
+		return Config{}, fmt.Errorf("expected at most one config file but got: %v", fs.Args())
+	}
+
+	env := envMap(environ)
+	for _, f := range fields {
+		v, ok := env[f.envName()]
+		if !ok {
+			continue
+		}
+		if err := f.set(v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %s: %w", f.envName(), err))
+		}
+	}
+	for _, fv := range flags {
+		if !fv.isSet {
+			continue
+		}
+		if err := fv.field.set(fv.raw); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for -%s: %w", fv.field.flagName(), err))
+		}
+	}
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+	if len(errs) > 0 {
+		return Config{}, errs
+	}
+
+	return c, nil
+}
+
+// FileArg returns the config file given in args,
+// or an empty string if args do not include one.
+func FileArg(args []string) string {
+	c := Defaults()
+	fs, _ := newFlagSet("", configFields(&c), io.Discard)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return ""
+	}
+	return fs.Arg(0)
+}
+
+// newFlagSet returns a flag set with a flag for every field.
+func newFlagSet(name string, fields []field, output io.Writer) (*flag.FlagSet, []*flagValue) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [config-file]\n\nFlags:\n", name)
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nEvery flag can also be set with the %s* environment variable\n"+
+			"named after its TOML path, e.g. %sAPI_PORT.\n", EnvPrefix, EnvPrefix)
+	}
+	flags := make([]*flagValue, len(fields))
+	for i, f := range fields {
+		flags[i] = &flagValue{field: f, def: f.String()}
+		fs.Var(flags[i], f.flagName(), f.usage())
+	}
+	return fs, flags
+}
+
+// decodeFile decodes the TOML file in path into c. The keys in the
+// file that do not match any configuration field are returned as
+// errors, as they are usually typos.
+func decodeFile(path string, c *Config) (Errors, error) {
+	configData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read configuration file: %w", err)
+	}
+	md, err := toml.Decode(string(configData), c)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode configuration file: %w", err)
+	}
+	var errs Errors
+	for _, key := range md.Undecoded() {
+		errs = append(errs, fmt.Errorf("%s: unknown configuration key in %s", key, path))
+	}
+	return errs, nil
+}
+
+func envMap(environ []string) map[string]string {
+	env := map[string]string{}
+	for _, kv := range environ {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok && strings.HasPrefix(k, EnvPrefix) {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// flagValue records the raw value of a flag, so it can
+// be applied after the file and the environment.
+type flagValue struct {
+	field field
+	def   string
+	raw   string
+	isSet bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.def
+}
+
+// Set records s. The value is parsed when it is applied, so
+// invalid values are reported together with the rest of errors.
+func (v *flagValue) Set(s string) error {
+	v.raw, v.isSet = s, true
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.field.value.Kind() == reflect.Bool
+}
+
+// field is a scalar configuration field.
+type field struct {
+	// path are the TOML keys of the field from
+	// the root, e.g. ["Sender", "PingInterval"].
+	path   []string
+	value  reflect.Value
+	secret bool
+}
+
+func (f field) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.Join(f.path, "_"))
+}
+
+func (f field) flagName() string {
+	return strings.ToLower(strings.Join(f.path, "."))
+}
+
+func (f field) key() string {
+	return strings.Join(f.path, ".")
+}
+
+func (f field) usage() string {
+	return fmt.Sprintf("%s (env %s)", f.key(), f.envName())
+}
+
+// set parses s and sets it as the value of the field.
+func (f field) set(s string) error {
+	v := f.value
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		fl, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(fl)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// String returns the TOML representation of the value of the field.
+func (f field) String() string {
+	v := f.value
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Do not use the String method of
+		// named types, like time.Duration.
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float32, reflect.Float64:
+		s := strconv.FormatFloat(v.Float(), 'f', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = strconv.Quote(v.Index(i).String())
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// configFields returns the scalar fields of c.
+func configFields(c *Config) []field {
+	return structFields(reflect.ValueOf(c).Elem(), nil)
+}
+
+func structFields(v reflect.Value, path []string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := tomlKey(sf)
+		if key == "-" {
+			continue
+		}
+		p := append(append([]string(nil), path...), key)
+		fv := v.Field(i)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			fields = append(fields, structFields(fv, p)...)
+		case isScalar(fv.Type()):
+			fields = append(fields, field{
+				path:   p,
+				value:  fv,
+				secret: sf.Tag.Get("secret") == "true",
+			})
+		}
+	}
+	return fields
+}
+
+func tomlKey(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("toml"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
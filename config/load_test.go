@@ -0,0 +1,159 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		environ []string
+		check   func(t *testing.T, cfg Config)
+		wantErr []string
+	}{
+		{
+			name: "Defaults",
+			check: func(t *testing.T, cfg Config) {
+				if !reflect.DeepEqual(cfg, Defaults()) {
+					t.Errorf("expected defaults:\n%+v\nbut got:\n%+v", Defaults(), cfg)
+				}
+			},
+		},
+		{
+			name: "File overrides defaults",
+			args: []string{"../_resources/config/test.toml"},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.Logger.LogLevel != logLevel {
+					t.Errorf("expected log level %q but got %q", logLevel, cfg.Logger.LogLevel)
+				}
+				if cfg.Sender.PingInterval != pingInterval {
+					t.Errorf("expected ping interval %d but got %d", pingInterval, cfg.Sender.PingInterval)
+				}
+			},
+		},
+		{
+			name: "Env overrides file and flags override env",
+			args: []string{"-api.port", "9090", "-storage.tls", "../_resources/config/test.toml"},
+			environ: []string{
+				"VULCAN_STREAM_API_PORT=9000",
+				"VULCAN_STREAM_STORAGE_HOST=redis",
+				"VULCAN_STREAM_STORAGE_ADDRS=node1:6379, node2:6379",
+				"VULCAN_STREAM_METRICS_ENABLED=true",
+				"API_PORT=1",
+			},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.API.Port != 9090 {
+					t.Errorf("expected port 9090 but got %d", cfg.API.Port)
+				}
+				if cfg.Storage.Host != "redis" {
+					t.Errorf("expected host redis but got %q", cfg.Storage.Host)
+				}
+				if want := []string{"node1:6379", "node2:6379"}; !reflect.DeepEqual(cfg.Storage.Addrs, want) {
+					t.Errorf("expected addrs %v but got %v", want, cfg.Storage.Addrs)
+				}
+				if !cfg.Storage.TLS || !cfg.Metrics.Enabled {
+					t.Errorf("expected TLS and metrics to be enabled")
+				}
+			},
+		},
+		{
+			name:    "A zero value overrides the default",
+			environ: []string{"VULCAN_STREAM_TRACING_SAMPLERATIO=0"},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.Tracing.SampleRatio != 0 {
+					t.Errorf("expected sample ratio 0 but got %v", cfg.Tracing.SampleRatio)
+				}
+			},
+		},
+		{
+			name:    "Errors are reported as a list",
+			args:    []string{"-sender.pinginterval", "often"},
+			environ: []string{"VULCAN_STREAM_API_PORT=http", "VULCAN_STREAM_CACHE_DEGRADED=maybe"},
+			wantErr: []string{
+				"VULCAN_STREAM_API_PORT",
+				"VULCAN_STREAM_CACHE_DEGRADED",
+				"-sender.pinginterval",
+			},
+		},
+		{
+			name:    "Missing file",
+			args:    []string{"missing.toml"},
+			wantErr: []string{"cannot read configuration file"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := Load("test", tc.args, tc.environ, io.Discard)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error but got: %v", err)
+				}
+				tc.check(t, cfg)
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors but got none")
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q but got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadErrorsList(t *testing.T) {
+	_, err := Load("test", nil, []string{"VULCAN_STREAM_API_PORT=x", "VULCAN_STREAM_STORAGE_DB=y"}, io.Discard)
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors but got: %T", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors but got %d: %v", len(errs), errs)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := Defaults()
+	cfg.Storage.Pwd = "s3cr3t"
+
+	var b bytes.Buffer
+	if err := Print(&b, cfg); err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	out := b.String()
+
+	if strings.Contains(out, "s3cr3t") {
+		t.Errorf("expected secrets to be redacted:\n%s", out)
+	}
+	for _, want := range []string{"[Storage]\n", `Pwd = "REDACTED"`, `SentinelPwd = ""`, "PingInterval = 10\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	a := Defaults()
+	b := Defaults()
+	b.Logger.LogLevel = "ERROR"
+	b.Sender.PingInterval = 30
+	b.Storage.Addrs = []string{}
+
+	got := Changed(a, b)
+	if want := []string{"Logger.LogLevel", "Sender.PingInterval"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected changed fields to be %v but got %v", want, got)
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// redacted replaces the value of the secret fields when printing the config.
+const redacted = `"REDACTED"`
+
+// Print writes c to w in TOML format, with the value of the secret
+// fields redacted.
+func Print(w io.Writer, c Config) error {
+	var (
+		b       strings.Builder
+		section string
+	)
+	for _, f := range configFields(&c) {
+		if f.path[0] != section {
+			if section != "" {
+				b.WriteString("\n")
+			}
+			section = f.path[0]
+			fmt.Fprintf(&b, "[%s]\n", section)
+		}
+		value := f.String()
+		if f.secret && !f.value.IsZero() {
+			value = redacted
+		}
+		fmt.Fprintf(&b, "%s = %s\n", strings.Join(f.path[1:], "."), value)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
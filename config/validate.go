@@ -0,0 +1,185 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	stream "github.com/adevinta/vulcan-stream"
+)
+
+// Validate checks the configuration and returns all the problems
+// found as an Errors value, or nil if the configuration is valid.
+func (c Config) Validate() error {
+	var errs Errors
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	// Logger
+	if _, err := stream.ParseLogLevel(c.Logger.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("Logger.LogLevel: %w", err))
+	}
+	if err := stream.ValidateLogFormat(c.Logger.Format); err != nil {
+		errs = append(errs, fmt.Errorf("Logger.Format: %w", err))
+	}
+	check(c.Logger.MaxSize >= 0, "Logger.MaxSize", "must not be negative, got %d", c.Logger.MaxSize)
+	check(c.Logger.RotateInterval >= 0, "Logger.RotateInterval", "must not be negative, got %d", c.Logger.RotateInterval)
+	check(c.Logger.MaxAge >= 0, "Logger.MaxAge", "must not be negative, got %d", c.Logger.MaxAge)
+	check(c.Logger.MaxBackups >= 0, "Logger.MaxBackups", "must not be negative, got %d", c.Logger.MaxBackups)
+
+	// Sender
+	check(validTopic.MatchString(c.Sender.HTTPStream), "Sender.HTTPStream", "must be a valid topic name, got %q", c.Sender.HTTPStream)
+	topics := map[string]bool{c.Sender.HTTPStream: true}
+	for _, t := range c.Sender.Topics {
+		check(validTopic.MatchString(t), "Sender.Topics", "must be valid topic names, got %q", t)
+		check(!topics[t], "Sender.Topics", "must not be repeated, got %q more than once", t)
+		topics[t] = true
+	}
+	check(c.Sender.PingInterval > 0, "Sender.PingInterval", "must be a positive number of seconds, got %d", c.Sender.PingInterval)
+	check(c.Sender.QueueSize >= 0, "Sender.QueueSize", "must not be negative, got %d", c.Sender.QueueSize)
+	check(c.Sender.WriteTimeout >= 0, "Sender.WriteTimeout", "must not be negative, got %d", c.Sender.WriteTimeout)
+	if c.Sender.Compression {
+		check(c.Sender.CompressionLevel >= 1 && c.Sender.CompressionLevel <= 9, "Sender.CompressionLevel", "must be between 1 and 9, got %d", c.Sender.CompressionLevel)
+	}
+	check(c.Sender.CompressionThreshold >= 0, "Sender.CompressionThreshold", "must not be negative, got %d", c.Sender.CompressionThreshold)
+	check(len(c.Sender.PublicKeyFiles) == 0 || c.Sender.SigningKeyFile != "", "Sender.PublicKeyFiles", "requires Sender.SigningKeyFile")
+	switch c.Sender.OverflowPolicy {
+	case "", stream.OverflowDropOldest, stream.OverflowDisconnect:
+	default:
+		check(false, "Sender.OverflowPolicy", "must be %s or %s, got %q",
+			stream.OverflowDropOldest, stream.OverflowDisconnect, c.Sender.OverflowPolicy)
+	}
+
+	// API
+	check(validPort(c.API.Port), "API.Port", "must be between 1 and 65535, got %d", c.API.Port)
+	for _, action := range c.API.Actions {
+		check(action != "" && action != "ping", "API.Actions", "must not be empty or ping, got %q", action)
+	}
+	check(c.API.CacheMaxAge >= 0, "API.CacheMaxAge", "must not be negative, got %d", c.API.CacheMaxAge)
+	check(c.API.ScheduleInterval >= 0, "API.ScheduleInterval", "must not be negative, got %d", c.API.ScheduleInterval)
+
+	// Storage
+	s := c.Storage
+	switch s.Mode {
+	case "", stream.RedisModeStandalone:
+		if len(s.Addrs) == 0 {
+			check(s.Host != "", "Storage.Host", "must not be empty")
+			check(validPort(s.Port), "Storage.Port", "must be between 1 and 65535, got %d", s.Port)
+		}
+	case stream.RedisModeSentinel:
+		check(s.MasterName != "", "Storage.MasterName", "is required in sentinel mode")
+		check(len(s.Addrs) > 0, "Storage.Addrs", "must list the sentinels in sentinel mode")
+	case stream.RedisModeCluster:
+		check(len(s.Addrs) > 0, "Storage.Addrs", "must list the cluster nodes in cluster mode")
+		check(s.DB == 0, "Storage.DB", "must be 0 in cluster mode, got %d", s.DB)
+	default:
+		check(false, "Storage.Mode", "must be one of %s, %s or %s, got %q",
+			stream.RedisModeStandalone, stream.RedisModeSentinel, stream.RedisModeCluster, s.Mode)
+	}
+	check(s.DB >= 0, "Storage.DB", "must not be negative, got %d", s.DB)
+	check(s.TTL >= 0, "Storage.TTL", "must not be negative, got %d", s.TTL)
+	check(s.TLSCAFile == "" || s.TLS, "Storage.TLSCAFile", "requires Storage.TLS to be enabled")
+
+	// Cache
+	check(c.Cache.ReplayInterval >= 0, "Cache.ReplayInterval", "must not be negative, got %d", c.Cache.ReplayInterval)
+	check(c.Cache.MaxPending >= 0, "Cache.MaxPending", "must not be negative, got %d", c.Cache.MaxPending)
+	check(c.Cache.SnapshotInterval >= 0, "Cache.SnapshotInterval", "must not be negative, got %d", c.Cache.SnapshotInterval)
+
+	// Metrics
+	p := c.Metrics.PrometheusPath
+	check(p == "" || strings.HasPrefix(p, "/"), "Metrics.PrometheusPath", "must start with /, got %q", p)
+
+	// Tracing
+	r := c.Tracing.SampleRatio
+	check(r >= 0 && r <= 1, "Tracing.SampleRatio", "must be between 0 and 1, got %v", r)
+
+	// Audit
+	a := c.Audit
+	switch a.Sink {
+	case "", stream.AuditSinkRedis:
+	case stream.AuditSinkFile:
+		check(a.File != "", "Audit.File", "is required with the file sink")
+	default:
+		check(false, "Audit.Sink", "must be empty, %s or %s, got %q", stream.AuditSinkFile, stream.AuditSinkRedis, a.Sink)
+	}
+	check(a.MaxLen >= 0, "Audit.MaxLen", "must not be negative, got %d", a.MaxLen)
+
+	// RateLimit
+	l := c.RateLimit
+	check(l.Rate >= 0, "RateLimit.Rate", "must not be negative, got %v", l.Rate)
+	check(l.Burst >= 0, "RateLimit.Burst", "must not be negative, got %d", l.Burst)
+	check(l.MaxSubscribers >= 0, "RateLimit.MaxSubscribers", "must not be negative, got %d", l.MaxSubscribers)
+	check(l.MaxSubscribersPerAgent >= 0, "RateLimit.MaxSubscribersPerAgent", "must not be negative, got %d", l.MaxSubscribersPerAgent)
+	check(l.MaxSubscribersPerIP >= 0, "RateLimit.MaxSubscribersPerIP", "must not be negative, got %d", l.MaxSubscribersPerIP)
+
+	// Webhooks
+	w := c.Webhooks
+	check(w.MaxRetries >= 0, "Webhooks.MaxRetries", "must not be negative, got %d", w.MaxRetries)
+	check(w.Backoff >= 0, "Webhooks.Backoff", "must not be negative, got %d", w.Backoff)
+	check(w.MaxBackoff >= w.Backoff, "Webhooks.MaxBackoff", "must not be lower than Webhooks.Backoff, got %d", w.MaxBackoff)
+	check(w.Timeout > 0, "Webhooks.Timeout", "must be a positive number of seconds, got %d", w.Timeout)
+	check(w.QueueSize > 0, "Webhooks.QueueSize", "must be positive, got %d", w.QueueSize)
+	check(w.DeadLetterKey != "", "Webhooks.DeadLetterKey", "must not be empty")
+	check(w.MaxDeadLetters >= 0, "Webhooks.MaxDeadLetters", "must not be negative, got %d", w.MaxDeadLetters)
+
+	// Ingest
+	in := c.Ingest
+	check(in.DedupTTL >= 0, "Ingest.DedupTTL", "must not be negative, got %d", in.DedupTTL)
+	switch in.Source {
+	case "":
+	case stream.IngestSourceNATS:
+		check(in.NATSURL != "", "Ingest.NATSURL", "must be set for the %s source", in.Source)
+		check(in.NATSStream != "", "Ingest.NATSStream", "must be set for the %s source", in.Source)
+		check(in.NATSConsumer != "", "Ingest.NATSConsumer", "must be set for the %s source", in.Source)
+	case stream.IngestSourceKafka:
+		check(len(in.KafkaBrokers) > 0, "Ingest.KafkaBrokers", "must be set for the %s source", in.Source)
+		check(in.KafkaTopic != "", "Ingest.KafkaTopic", "must be set for the %s source", in.Source)
+		check(in.KafkaGroupID != "", "Ingest.KafkaGroupID", "must be set for the %s source", in.Source)
+	case stream.IngestSourceSQS:
+		check(in.SQSQueueURL != "", "Ingest.SQSQueueURL", "must be set for the %s source", in.Source)
+	default:
+		check(false, "Ingest.Source", "must be empty, %s, %s or %s, got %q",
+			stream.IngestSourceNATS, stream.IngestSourceKafka, stream.IngestSourceSQS, in.Source)
+	}
+
+	// Bridge
+	b := c.Bridge
+	switch b.Sink {
+	case "", stream.BridgeSinkRedis:
+	case stream.BridgeSinkKafka:
+		check(len(b.KafkaBrokers) > 0, "Bridge.KafkaBrokers", "must be set for the %s sink", b.Sink)
+	case stream.BridgeSinkNATS:
+		check(b.NATSURL != "", "Bridge.NATSURL", "must be set for the %s sink", b.Sink)
+	default:
+		check(false, "Bridge.Sink", "must be empty, %s, %s or %s, got %q",
+			stream.BridgeSinkKafka, stream.BridgeSinkNATS, stream.BridgeSinkRedis, b.Sink)
+	}
+	check(b.Destination != "", "Bridge.Destination", "must not be empty")
+	check(b.Delivery == stream.BridgeAtMostOnce || b.Delivery == stream.BridgeAtLeastOnce,
+		"Bridge.Delivery", "must be %s or %s, got %q", stream.BridgeAtMostOnce, stream.BridgeAtLeastOnce, b.Delivery)
+	_, err := stream.ParseTopicMap(b.TopicMap)
+	check(err == nil, "Bridge.TopicMap", "%v", err)
+	check(b.QueueSize > 0, "Bridge.QueueSize", "must be positive, got %d", b.QueueSize)
+	check(b.Backoff >= 0, "Bridge.Backoff", "must not be negative, got %d", b.Backoff)
+	check(b.MaxBackoff >= b.Backoff, "Bridge.MaxBackoff", "must not be lower than Bridge.Backoff, got %d", b.MaxBackoff)
+	check(b.RedisMaxLen >= 0, "Bridge.RedisMaxLen", "must not be negative, got %d", b.RedisMaxLen)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validTopic matches the topic names, which are part of the stream URL.
+var validTopic = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr []string
+	}{
+		{
+			name:   "Defaults are valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name: "Nonsense values",
+			modify: func(c *Config) {
+				c.API.Port = 0
+				c.Sender.PingInterval = 0
+				c.Logger.LogLevel = "VERBOSE"
+				c.Tracing.SampleRatio = 2
+			},
+			wantErr: []string{"API.Port", "Sender.PingInterval", "Logger.LogLevel", "Tracing.SampleRatio"},
+		},
+		{
+			name:   "Log level is not case sensitive",
+			modify: func(c *Config) { c.Logger.LogLevel = "warn" },
+		},
+		{
+			name: "Sentinel without master",
+			modify: func(c *Config) {
+				c.Storage.Mode = "sentinel"
+			},
+			wantErr: []string{"Storage.MasterName", "Storage.Addrs"},
+		},
+		{
+			name: "Cluster with DB",
+			modify: func(c *Config) {
+				c.Storage.Mode = "cluster"
+				c.Storage.Addrs = []string{"node1:6379"}
+				c.Storage.DB = 2
+			},
+			wantErr: []string{"Storage.DB"},
+		},
+		{
+			name: "Unknown log format and negative rotation",
+			modify: func(c *Config) {
+				c.Logger.Format = "xml"
+				c.Logger.MaxAge = -1
+			},
+			wantErr: []string{"Logger.Format", "Logger.MaxAge"},
+		},
+		{
+			name: "Invalid and repeated topics",
+			modify: func(c *Config) {
+				c.Sender.Topics = []string{"scan-events", "bad/topic", "scan-events", "stream"}
+			},
+			wantErr: []string{"bad/topic", `"scan-events" more than once`, `"stream" more than once`},
+		},
+		{
+			name:    "Unknown overflow policy",
+			modify:  func(c *Config) { c.Sender.OverflowPolicy = "block" },
+			wantErr: []string{"Sender.OverflowPolicy"},
+		},
+		{
+			name: "Invalid compression",
+			modify: func(c *Config) {
+				c.Sender.Compression = true
+				c.Sender.CompressionLevel = 10
+				c.Sender.CompressionThreshold = -1
+			},
+			wantErr: []string{"Sender.CompressionLevel", "Sender.CompressionThreshold"},
+		},
+		{
+			name: "Invalid webhook backoff",
+			modify: func(c *Config) {
+				c.Webhooks.Backoff = 10
+				c.Webhooks.MaxBackoff = 5
+			},
+			wantErr: []string{"Webhooks.MaxBackoff"},
+		},
+		{
+			name: "Webhooks without queue",
+			modify: func(c *Config) {
+				c.Webhooks.QueueSize = 0
+				c.Webhooks.Timeout = 0
+				c.Webhooks.DeadLetterKey = ""
+			},
+			wantErr: []string{"Webhooks.QueueSize", "Webhooks.Timeout", "Webhooks.DeadLetterKey"},
+		},
+		{
+			name: "Kafka ingestion without brokers",
+			modify: func(c *Config) {
+				c.Ingest.Source = "kafka"
+				c.Ingest.KafkaTopic = "commands"
+			},
+			wantErr: []string{"Ingest.KafkaBrokers", "Ingest.KafkaGroupID"},
+		},
+		{
+			name: "Invalid bridge",
+			modify: func(c *Config) {
+				c.Bridge.Sink = "nats"
+				c.Bridge.Delivery = "exactly_once"
+				c.Bridge.TopicMap = []string{"stream=vulcan.aborts", "events"}
+				c.Bridge.Destination = ""
+			},
+			wantErr: []string{"Bridge.NATSURL", "Bridge.Destination", "Bridge.Delivery", "Bridge.TopicMap"},
+		},
+		{
+			name:    "File audit without file",
+			modify:  func(c *Config) { c.Audit.Sink = "file" },
+			wantErr: []string{"Audit.File"},
+		},
+		{
+			name:    "Unknown redis mode",
+			modify:  func(c *Config) { c.Storage.Mode = "replicated" },
+			wantErr: []string{"Storage.Mode"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Defaults()
+			tc.modify(&c)
+			err := c.Validate()
+
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error but got: %v", err)
+				}
+				return
+			}
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected Errors but got: %v", err)
+			}
+			if len(errs) != len(tc.wantErr) {
+				t.Fatalf("expected %d errors but got %d:\n%v", len(tc.wantErr), len(errs), err)
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q but got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadConfigUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	data := "[Sender]\nPingInterval = 5\nPingIntervall = 5\n\n[Sendr]\nHTTPStream = \"stream\"\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ReadConfig(path)
+	if err == nil {
+		t.Fatalf("expected unknown keys to be reported")
+	}
+	for _, want := range []string{"Sender.PingIntervall", "Sendr.HTTPStream"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q but got:\n%v", want, err)
+		}
+	}
+}
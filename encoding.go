@@ -0,0 +1,257 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Websocket subprotocols the agents can negotiate to choose the
+// encoding of the messages. The messages are encoded in JSON if
+// none of them is negotiated.
+const (
+	SubprotocolJSON     = "vulcan-stream.json"
+	SubprotocolMsgpack  = "vulcan-stream.msgpack"
+	SubprotocolProtobuf = "vulcan-stream.protobuf"
+)
+
+// MessageProto is the Protocol Buffers definition of the
+// messages sent with the SubprotocolProtobuf subprotocol.
+//
+//go:embed schema/message.proto
+var MessageProto []byte
+
+// ErrUnknownSubprotocol is returned when encoding or
+// decoding messages for an unsupported subprotocol.
+var ErrUnknownSubprotocol = errors.New("unknown subprotocol")
+
+// selectSubprotocol returns the first subprotocol requested by
+// the agent in r that is supported, or an empty string if none is.
+func selectSubprotocol(r *http.Request) string {
+	for _, p := range websocket.Subprotocols(r) {
+		switch p {
+		case SubprotocolJSON, SubprotocolMsgpack, SubprotocolProtobuf:
+			return p
+		}
+	}
+	return ""
+}
+
+// EncodeMessage encodes msg for the given subprotocol and returns
+// the websocket message type it must be sent with. The JSON encoding
+// is used if subprotocol is empty.
+//
+// The payload is kept as JSON in every encoding, and the signature
+// fields are the ones of the JSON encoding. See VerifyMessage.
+func EncodeMessage(subprotocol string, msg Message) (int, []byte, error) {
+	switch subprotocol {
+	case "", SubprotocolJSON:
+		data, err := json.Marshal(msg)
+		return websocket.TextMessage, data, err
+	case SubprotocolMsgpack:
+		data, err := marshalMsgpack(msg)
+		return websocket.BinaryMessage, data, err
+	case SubprotocolProtobuf:
+		return websocket.BinaryMessage, marshalProto(msg), nil
+	}
+	return 0, nil, fmt.Errorf("%w: %q", ErrUnknownSubprotocol, subprotocol)
+}
+
+// DecodeMessage decodes a message received from the stream
+// with the given subprotocol.
+func DecodeMessage(subprotocol string, data []byte) (Message, error) {
+	var msg Message
+	var err error
+	switch subprotocol {
+	case "", SubprotocolJSON:
+		err = json.Unmarshal(data, &msg)
+	case SubprotocolMsgpack:
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		err = dec.Decode(&msg)
+	case SubprotocolProtobuf:
+		msg, err = unmarshalProto(data)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownSubprotocol, subprotocol)
+	}
+	return msg, err
+}
+
+// marshalMsgpack encodes msg as a MessagePack map with the
+// same keys as the JSON encoding.
+func marshalMsgpack(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Field numbers of schema/message.proto.
+const (
+	protoCheckID protowire.Number = iota + 1
+	protoAgentID
+	protoScanID
+	protoAction
+	protoTraceParent
+	protoID
+	protoCreatedAt
+	protoVersion
+	protoPayload
+	protoKeyID
+	protoSig
+)
+
+// Field numbers of google.protobuf.Timestamp.
+const (
+	protoSeconds protowire.Number = 1
+	protoNanos   protowire.Number = 2
+)
+
+// marshalProto encodes msg as defined in schema/message.proto.
+func marshalProto(msg Message) []byte {
+	var b []byte
+	appendString := func(num protowire.Number, v string) {
+		if v != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		}
+	}
+	appendString(protoCheckID, msg.CheckID)
+	appendString(protoAgentID, msg.AgentID)
+	appendString(protoScanID, msg.ScanID)
+	appendString(protoAction, msg.Action)
+	appendString(protoTraceParent, msg.TraceParent)
+	appendString(protoID, msg.ID)
+	if !msg.CreatedAt.IsZero() {
+		var ts []byte
+		ts = protowire.AppendTag(ts, protoSeconds, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(msg.CreatedAt.Unix()))
+		if nanos := msg.CreatedAt.Nanosecond(); nanos != 0 {
+			ts = protowire.AppendTag(ts, protoNanos, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(nanos))
+		}
+		b = protowire.AppendTag(b, protoCreatedAt, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+	if msg.Version != 0 {
+		b = protowire.AppendTag(b, protoVersion, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(msg.Version))
+	}
+	if len(msg.Payload) > 0 {
+		b = protowire.AppendTag(b, protoPayload, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg.Payload)
+	}
+	appendString(protoKeyID, msg.KeyID)
+	appendString(protoSig, msg.Sig)
+	return b
+}
+
+// unmarshalProto decodes a message encoded as defined in
+// schema/message.proto. Unknown fields are ignored.
+func unmarshalProto(b []byte) (Message, error) {
+	var msg Message
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return Message{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v []byte
+		var u uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			u, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return Message{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch num {
+		case protoCheckID:
+			msg.CheckID = string(v)
+		case protoAgentID:
+			msg.AgentID = string(v)
+		case protoScanID:
+			msg.ScanID = string(v)
+		case protoAction:
+			msg.Action = string(v)
+		case protoTraceParent:
+			msg.TraceParent = string(v)
+		case protoID:
+			msg.ID = string(v)
+		case protoCreatedAt:
+			t, err := unmarshalProtoTimestamp(v)
+			if err != nil {
+				return Message{}, err
+			}
+			msg.CreatedAt = t
+		case protoVersion:
+			msg.Version = int(u)
+		case protoPayload:
+			msg.Payload = json.RawMessage(bytes.Clone(v))
+		case protoKeyID:
+			msg.KeyID = string(v)
+		case protoSig:
+			msg.Sig = string(v)
+		}
+	}
+	return msg, nil
+}
+
+func unmarshalProtoTimestamp(b []byte) (time.Time, error) {
+	var secs, nanos int64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.VarintType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return time.Time{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch num {
+		case protoSeconds:
+			secs = int64(v)
+		case protoNanos:
+			nanos = int64(v)
+		}
+	}
+	return time.Unix(secs, nanos).UTC(), nil
+}
+
+// protoHandler returns the Protocol Buffers definition of the stream messages.
+func (a *API) protoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(MessageProto)
+}
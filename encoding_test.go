@@ -0,0 +1,138 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestEncodeMessage(t *testing.T) {
+	msg := stamp(Message{
+		CheckID:     "c1",
+		ScanID:      "s1",
+		Action:      actionAbort,
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		Payload:     json.RawMessage(`{"reason":"timeout"}`),
+		KeyID:       "k1",
+		Sig:         "sig",
+	})
+
+	testCases := []struct {
+		subprotocol string
+		wantType    int
+	}{
+		{subprotocol: "", wantType: websocket.TextMessage},
+		{subprotocol: SubprotocolJSON, wantType: websocket.TextMessage},
+		{subprotocol: SubprotocolMsgpack, wantType: websocket.BinaryMessage},
+		{subprotocol: SubprotocolProtobuf, wantType: websocket.BinaryMessage},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.subprotocol, func(t *testing.T) {
+			typ, data, err := EncodeMessage(tc.subprotocol, msg)
+			if err != nil {
+				t.Fatalf("expected no error encoding message but got: %v", err)
+			}
+			if typ != tc.wantType {
+				t.Errorf("expected message type %d but got %d", tc.wantType, typ)
+			}
+			got, err := DecodeMessage(tc.subprotocol, data)
+			if err != nil {
+				t.Fatalf("expected no error decoding message but got: %v", err)
+			}
+			if !got.CreatedAt.Equal(msg.CreatedAt) {
+				t.Errorf("expected created_at %v but got %v", msg.CreatedAt, got.CreatedAt)
+			}
+			got.CreatedAt = msg.CreatedAt
+			if !reflect.DeepEqual(got, msg) {
+				t.Errorf("expected decoded message %+v but got %+v", msg, got)
+			}
+		})
+	}
+
+	if _, _, err := EncodeMessage("xml", msg); err == nil {
+		t.Error("expected error encoding message for an unknown subprotocol")
+	}
+}
+
+func TestSenderSubprotocols(t *testing.T) {
+	keyFile, _ := writeKey(t, t.TempDir(), "key")
+	k, err := LoadKeyring(SenderConfig{SigningKeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("expected no error loading keyring but got: %v", err)
+	}
+	keys, err := k.JWKS().PublicKeys()
+	if err != nil {
+		t.Fatalf("expected no error reading public keys but got: %v", err)
+	}
+
+	logger := log.New()
+	s := NewSender(logger, SenderConfig{HTTPStream: "stream"})
+	s.SetKeyring(k)
+	api := NewAPI(0, s, mockStorage{}, logger, nil)
+	srv := httptest.NewServer(api.mux)
+	defer srv.Close()
+
+	testCases := []struct {
+		name            string
+		subprotocols    []string
+		wantSubprotocol string
+	}{
+		{name: "Default"},
+		{name: "JSON", subprotocols: []string{SubprotocolJSON}, wantSubprotocol: SubprotocolJSON},
+		{name: "MessagePack", subprotocols: []string{SubprotocolMsgpack}, wantSubprotocol: SubprotocolMsgpack},
+		{
+			name:            "Agent preference",
+			subprotocols:    []string{"unknown", SubprotocolProtobuf, SubprotocolJSON},
+			wantSubprotocol: SubprotocolProtobuf,
+		},
+	}
+
+	conns := make([]*websocket.Conn, len(testCases))
+	for i, tc := range testCases {
+		dialer := websocket.Dialer{Subprotocols: tc.subprotocols}
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream", nil)
+		if err != nil {
+			t.Fatalf("expected no error connecting but got: %v", err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+	waitSubscribers(t, s, len(testCases))
+
+	s.Broadcast(context.Background(), Message{CheckID: "c1", Action: actionAbort})
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := conns[i]
+			if got := conn.Subprotocol(); got != tc.wantSubprotocol {
+				t.Fatalf("expected subprotocol %q but got %q", tc.wantSubprotocol, got)
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("expected no error reading message but got: %v", err)
+			}
+			msg, err := DecodeMessage(conn.Subprotocol(), data)
+			if err != nil {
+				t.Fatalf("expected no error decoding message but got: %v", err)
+			}
+			if msg.CheckID != "c1" || msg.ID == "" {
+				t.Errorf("unexpected message %+v", msg)
+			}
+			if err := VerifyMessage(msg, keys); err != nil {
+				t.Errorf("expected valid signature but got: %v", err)
+			}
+		})
+	}
+}
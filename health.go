@@ -0,0 +1,124 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	statusOK          = "ok"
+	statusDegraded    = "degraded"
+	statusUnavailable = "unavailable"
+
+	readyTimeout   = 2 * time.Second
+	defCacheMaxAge = 2 * rfshPeriod * time.Hour
+)
+
+// HealthResponse is the body returned by the
+// liveness and readiness endpoints.
+type HealthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+// ComponentStatus describes the status of
+// one of the components of the stream.
+type ComponentStatus struct {
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Size     *int       `json:"size,omitempty"`
+	Pending  *int       `json:"pending,omitempty"`
+	LastSync *time.Time `json:"last_sync,omitempty"`
+}
+
+// WithCacheMaxAge sets how long the local cache can go without being
+// synced with the remote DB before the stream is reported as not ready.
+func WithCacheMaxAge(d time.Duration) APIOption {
+	return func(a *API) {
+		if d > 0 {
+			a.cacheMaxAge = d
+		}
+	}
+}
+
+// healthzHandler reports whether the process is alive.
+func (a *API) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, HealthResponse{Status: statusOK})
+}
+
+// readyzHandler reports whether the stream is ready to serve agents,
+// that is, redis is reachable, the local cache has been loaded and is
+// not stale and the sender is running.
+//
+// While the storage is in degraded mode the stream keeps serving agents
+// from the local cache, so it is reported as degraded but still ready.
+func (a *API) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	st := a.storage.Status(ctx)
+	resp := HealthResponse{
+		Status:     statusOK,
+		Components: map[string]ComponentStatus{},
+	}
+
+	redis := ComponentStatus{Status: statusOK}
+	if st.RemoteErr != nil {
+		redis = ComponentStatus{Status: statusUnavailable, Error: st.RemoteErr.Error()}
+	}
+	if st.Degraded {
+		redis.Status = statusDegraded
+		redis.Pending = &st.Pending
+	}
+	resp.Components["redis"] = redis
+
+	cache := ComponentStatus{Status: statusOK, Size: &st.CacheSize}
+	switch {
+	case st.LastSync.IsZero():
+		cache.Status = statusUnavailable
+		cache.Error = "cache not loaded"
+	case time.Since(st.LastSync) > a.cacheMaxAge:
+		cache.Status = statusUnavailable
+		cache.Error = fmt.Sprintf("cache not synced for %s", time.Since(st.LastSync).Round(time.Second))
+	}
+	if st.Degraded && cache.Status != statusOK {
+		cache.Status = statusDegraded
+	}
+	if !st.LastSync.IsZero() {
+		cache.LastSync = &st.LastSync
+	}
+	resp.Components["cache"] = cache
+
+	sender := ComponentStatus{Status: statusOK}
+	if !a.sender.Running() {
+		sender = ComponentStatus{Status: statusUnavailable, Error: "sender not running"}
+	}
+	resp.Components["sender"] = sender
+
+	for _, c := range resp.Components {
+		switch {
+		case c.Status == statusUnavailable:
+			resp.Status = statusUnavailable
+		case c.Status == statusDegraded && resp.Status == statusOK:
+			resp.Status = statusDegraded
+		}
+	}
+	writeHealth(w, resp)
+}
+
+func writeHealth(w http.ResponseWriter, resp HealthResponse) {
+	code := http.StatusOK
+	if resp.Status == statusUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp) // nolint
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type mockStorage struct {
+	Storage
+	status StorageStatus
+}
+
+func (m mockStorage) Status(ctx context.Context) StorageStatus {
+	return m.status
+}
+
+func TestReadyzHandler(t *testing.T) {
+	testCases := []struct {
+		name          string
+		status        StorageStatus
+		senderRunning bool
+		wantCode      int
+		wantStatuses  map[string]string
+	}{
+		{
+			name:          "Ready",
+			status:        StorageStatus{CacheSize: 2, LastSync: time.Now()},
+			senderRunning: true,
+			wantCode:      http.StatusOK,
+			wantStatuses:  map[string]string{"redis": statusOK, "cache": statusOK, "sender": statusOK},
+		},
+		{
+			name:          "Redis unreachable",
+			status:        StorageStatus{RemoteErr: errors.New("connection refused"), LastSync: time.Now()},
+			senderRunning: true,
+			wantCode:      http.StatusServiceUnavailable,
+			wantStatuses:  map[string]string{"redis": statusUnavailable, "cache": statusOK, "sender": statusOK},
+		},
+		{
+			name:          "Stale cache",
+			status:        StorageStatus{LastSync: time.Now().Add(-3 * time.Hour)},
+			senderRunning: true,
+			wantCode:      http.StatusServiceUnavailable,
+			wantStatuses:  map[string]string{"redis": statusOK, "cache": statusUnavailable, "sender": statusOK},
+		},
+		{
+			name:          "Degraded",
+			status:        StorageStatus{RemoteErr: errors.New("connection refused"), Degraded: true, Pending: 1},
+			senderRunning: true,
+			wantCode:      http.StatusOK,
+			wantStatuses:  map[string]string{"redis": statusDegraded, "cache": statusDegraded, "sender": statusOK},
+		},
+		{
+			name:         "Cache not loaded and sender stopped",
+			status:       StorageStatus{},
+			wantCode:     http.StatusServiceUnavailable,
+			wantStatuses: map[string]string{"redis": statusOK, "cache": statusUnavailable, "sender": statusUnavailable},
+		},
+	}
+
+	logger := log.New()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := NewSender(logger, SenderConfig{HTTPStream: "stream"})
+			sender.running.Store(tc.senderRunning)
+			api := NewAPI(0, sender, mockStorage{status: tc.status}, logger, nil,
+				WithCacheMaxAge(time.Hour))
+
+			rec := httptest.NewRecorder()
+			api.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected status code %d but got %d", tc.wantCode, rec.Code)
+			}
+			var resp HealthResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("expected no error decoding response but got: %v", err)
+			}
+			for name, want := range tc.wantStatuses {
+				if got := resp.Components[name].Status; got != want {
+					t.Errorf("expected %s status to be %q but got %q", name, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+// Package hub manages websocket connections subscribed to topics.
+//
+// Every connection registered in a Hub gets a bounded send queue written
+// by its own write pump, so a slow connection does not delay the others,
+// and a read pump that detects when the connection is closed.
+package hub
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Policy is what a Hub does when the send queue of a connection is full.
+type Policy string
+
+const (
+	// DropOldest drops the oldest queued message to make room for the new one.
+	DropOldest Policy = "drop_oldest"
+	// Disconnect closes the connection.
+	Disconnect Policy = "disconnect"
+)
+
+// Outcome is the result of sending a message to a connection.
+type Outcome string
+
+const (
+	// Queued means the message was queued to be written.
+	Queued Outcome = "queued"
+	// DroppedOldest means the message was queued after
+	// dropping the oldest queued one.
+	DroppedOldest Outcome = "dropped_oldest"
+	// Disconnected means the connection was closed
+	// because its queue was full.
+	Disconnected Outcome = "disconnected"
+	// WriteError means writing a queued message failed
+	// and the connection was closed.
+	WriteError Outcome = "write_error"
+)
+
+// ErrQueueFull is the reason a connection is closed
+// with the Disconnect policy.
+var ErrQueueFull = errors.New("send queue full")
+
+const (
+	defQueueSize    = 64
+	defWriteTimeout = 10 * time.Second
+	defMaxReadSize  = 4096
+)
+
+// Config defines the behaviour of a Hub. The zero value is
+// valid and uses the defaults documented for each field.
+type Config struct {
+	// QueueSize is the number of messages queued for each connection
+	// before applying the Overflow policy. Defaults to 64.
+	QueueSize int
+	// Overflow is the policy applied when the queue of a connection
+	// is full. Defaults to DropOldest.
+	Overflow Policy
+	// WriteTimeout is the time a write to a connection can take
+	// before the connection is closed. Defaults to 10 seconds.
+	WriteTimeout time.Duration
+	// MaxReadSize is the maximum size of the messages read
+	// from the connections. Defaults to 4096 bytes.
+	MaxReadSize int64
+
+	// OnMessage, if set, is called by the read pump of a
+	// connection with every message read from it.
+	OnMessage func(c *Conn, msg []byte)
+	// OnSend, if set, is called with the outcome of every
+	// message sent to a connection.
+	OnSend func(c *Conn, o Outcome)
+	// OnWrite, if set, is called with every frame
+	// written to a connection.
+	OnWrite func(c *Conn, f Frame)
+	// OnClose, if set, is called once when a connection is
+	// unregistered, with the reason it was closed.
+	OnClose func(c *Conn, err error)
+}
+
+// Hub keeps track of the registered connections and
+// the topics each of them is subscribed to.
+type Hub struct {
+	cfg Config
+
+	mu     sync.RWMutex
+	conns  map[*Conn]struct{}
+	topics map[string]map[*Conn]struct{}
+}
+
+// New returns a Hub with the given configuration.
+func New(c Config) *Hub {
+	if c.QueueSize <= 0 {
+		c.QueueSize = defQueueSize
+	}
+	if c.Overflow == "" {
+		c.Overflow = DropOldest
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = defWriteTimeout
+	}
+	if c.MaxReadSize <= 0 {
+		c.MaxReadSize = defMaxReadSize
+	}
+	return &Hub{
+		cfg:    c,
+		conns:  make(map[*Conn]struct{}),
+		topics: make(map[string]map[*Conn]struct{}),
+	}
+}
+
+// Frame is a message queued for a connection, with its
+// websocket message type, e.g. websocket.BinaryMessage.
+type Frame struct {
+	Type int
+	Data []byte
+	// Prepared, if set, is written instead of Data, compressed if
+	// the connection negotiated compression. The frames without it
+	// are written uncompressed.
+	Prepared *websocket.PreparedMessage
+	// Compressed is the size of Data once compressed, if known.
+	Compressed int
+}
+
+// Conn is a websocket connection registered in a Hub.
+type Conn struct {
+	hub   *Hub
+	ws    *websocket.Conn
+	value interface{}
+	queue chan Frame
+	done  chan struct{}
+
+	// topics is guarded by the hub mutex.
+	topics  map[string]struct{}
+	closing sync.Once
+}
+
+// Value returns the value the connection was registered with.
+func (c *Conn) Value() interface{} {
+	return c.value
+}
+
+// Subprotocol returns the websocket subprotocol
+// negotiated for the connection, if any.
+func (c *Conn) Subprotocol() string {
+	return c.ws.Subprotocol()
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close unregisters the connection from its hub and closes it.
+func (c *Conn) Close() {
+	c.hub.unregister(c, nil)
+}
+
+// Register adds ws to the hub, subscribed to the given topics, and
+// starts its pumps. The value can be retrieved with Conn.Value, e.g.
+// to identify the connection in the hooks. The hub owns ws from then on.
+func (h *Hub) Register(ws *websocket.Conn, value interface{}, topics ...string) *Conn {
+	c := &Conn{
+		hub:    h,
+		ws:     ws,
+		value:  value,
+		queue:  make(chan Frame, h.cfg.QueueSize),
+		done:   make(chan struct{}),
+		topics: make(map[string]struct{}),
+	}
+
+	h.mu.Lock()
+	h.conns[c] = struct{}{}
+	for _, t := range topics {
+		h.subscribe(c, t)
+	}
+	h.mu.Unlock()
+
+	go h.writePump(c)
+	go h.readPump(c)
+	return c
+}
+
+// Subscribe adds c to the topic.
+func (h *Hub) Subscribe(c *Conn, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.conns[c]; ok {
+		h.subscribe(c, topic)
+	}
+}
+
+// subscribe adds c to the topic. It must be called with the lock held.
+func (h *Hub) subscribe(c *Conn, topic string) {
+	members, ok := h.topics[topic]
+	if !ok {
+		members = make(map[*Conn]struct{})
+		h.topics[topic] = members
+	}
+	members[c] = struct{}{}
+	c.topics[topic] = struct{}{}
+}
+
+// Unsubscribe removes c from the topic.
+func (h *Hub) Unsubscribe(c *Conn, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unsubscribe(c, topic)
+}
+
+// unsubscribe removes c from the topic. It must be called with the lock held.
+func (h *Hub) unsubscribe(c *Conn, topic string) {
+	delete(c.topics, topic)
+	if members, ok := h.topics[topic]; ok {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Topics returns the topics c is subscribed to.
+func (h *Hub) Topics(c *Conn) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for t := range c.topics {
+		topics = append(topics, t)
+	}
+	return topics
+}
+
+// Len returns the number of connections subscribed to the topic.
+func (h *Hub) Len(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
+
+// Count returns the number of registered connections.
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// Conns returns the registered connections.
+func (h *Hub) Conns() []*Conn {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// Publish queues msg as a text message for every
+// connection subscribed to the topic.
+func (h *Hub) Publish(topic string, msg []byte) {
+	f := Frame{Type: websocket.TextMessage, Data: msg}
+	h.PublishFunc(topic, func(*Conn) (Frame, error) { return f, nil })
+}
+
+// PublishFunc queues the frame returned by encode for every connection
+// subscribed to the topic, so the message can be encoded differently
+// for each connection, e.g. depending on its subprotocol. The
+// connections for which encode returns an error are skipped. encode
+// is called from a single goroutine.
+func (h *Hub) PublishFunc(topic string, encode func(c *Conn) (Frame, error)) {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.topics[topic]))
+	for c := range h.topics[topic] {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range conns {
+		f, err := encode(c)
+		if err != nil {
+			continue
+		}
+		h.send(c, f)
+	}
+}
+
+// Send queues msg as a text message for c.
+func (h *Hub) Send(c *Conn, msg []byte) {
+	h.send(c, Frame{Type: websocket.TextMessage, Data: msg})
+}
+
+// send queues msg for c, applying the overflow policy if its queue is full.
+func (h *Hub) send(c *Conn, msg Frame) {
+	select {
+	case c.queue <- msg:
+		h.sent(c, Queued)
+		return
+	default:
+	}
+
+	if h.cfg.Overflow == Disconnect {
+		h.sent(c, Disconnected)
+		h.unregister(c, ErrQueueFull)
+		return
+	}
+
+	// Several senders can race for the room made in the queue,
+	// so keep dropping the oldest message until the new one fits.
+	for {
+		select {
+		case <-c.queue:
+		default:
+		}
+		select {
+		case c.queue <- msg:
+			h.sent(c, DroppedOldest)
+			return
+		default:
+		}
+	}
+}
+
+func (h *Hub) sent(c *Conn, o Outcome) {
+	if h.cfg.OnSend != nil {
+		h.cfg.OnSend(c, o)
+	}
+}
+
+// unregister removes c from the hub and its topics and closes it.
+func (h *Hub) unregister(c *Conn, reason error) {
+	h.mu.Lock()
+	_, ok := h.conns[c]
+	if ok {
+		delete(h.conns, c)
+		for t := range c.topics {
+			h.unsubscribe(c, t)
+		}
+	}
+	h.mu.Unlock()
+
+	c.closing.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+	if ok && h.cfg.OnClose != nil {
+		h.cfg.OnClose(c, reason)
+	}
+}
+
+// readPump reads from the connection until it is closed,
+// and then unregisters it.
+func (h *Hub) readPump(c *Conn) {
+	c.ws.SetReadLimit(h.cfg.MaxReadSize)
+	for {
+		_, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			h.unregister(c, err)
+			return
+		}
+		if h.cfg.OnMessage != nil {
+			h.cfg.OnMessage(c, msg)
+		}
+	}
+}
+
+// writePump writes the messages queued for the
+// connection until the connection is closed.
+func (h *Hub) writePump(c *Conn) {
+	for {
+		select {
+		case f := <-c.queue:
+			c.ws.SetWriteDeadline(time.Now().Add(h.cfg.WriteTimeout))
+			if err := write(c.ws, f); err != nil {
+				h.sent(c, WriteError)
+				h.unregister(c, err)
+				return
+			}
+			if h.cfg.OnWrite != nil {
+				h.cfg.OnWrite(c, f)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// write writes f to ws. Only the prepared frames are compressed,
+// when ws negotiated compression.
+func write(ws *websocket.Conn, f Frame) error {
+	if f.Prepared != nil {
+		ws.EnableWriteCompression(true)
+		return ws.WritePreparedMessage(f.Prepared)
+	}
+	ws.EnableWriteCompression(false)
+	return ws.WriteMessage(f.Type, f.Data)
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package hub
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer registers in h the connections made to it,
+// subscribed to the topics in the topic query parameter.
+type testServer struct {
+	*httptest.Server
+	conns chan *Conn
+}
+
+func newTestServer(t *testing.T, h *Hub) *testServer {
+	conns := make(chan *Conn, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("expected no error upgrading connection but got: %v", err)
+			return
+		}
+		var topics []string
+		if topic := r.URL.Query().Get("topic"); topic != "" {
+			topics = strings.Split(topic, ",")
+		}
+		conns <- h.Register(ws, r.URL.Query().Get("id"), topics...)
+	}))
+	t.Cleanup(srv.Close)
+	return &testServer{Server: srv, conns: conns}
+}
+
+// dial connects to the server and returns the client
+// and the server side of the connection.
+func (s *testServer) dial(t *testing.T, query string) (*websocket.Conn, *Conn) {
+	t.Helper()
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"?"+query, nil)
+	if err != nil {
+		t.Fatalf("expected no error connecting but got: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, <-s.conns
+}
+
+func read(t *testing.T, client *websocket.Conn) string {
+	t.Helper()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, msg, err := client.ReadMessage()
+	if err != nil {
+		t.Fatalf("expected no error reading message but got: %v", err)
+	}
+	return string(msg)
+}
+
+func TestPublish(t *testing.T) {
+	h := New(Config{})
+	srv := newTestServer(t, h)
+
+	a, _ := srv.dial(t, "id=a&topic=t1")
+	b, connB := srv.dial(t, "id=b&topic=t1,t2")
+	c, _ := srv.dial(t, "id=c&topic=t2")
+
+	if got := h.Len("t1"); got != 2 {
+		t.Errorf("expected 2 connections in t1 but got %d", got)
+	}
+	if got := connB.Value(); got != "b" {
+		t.Errorf("expected connection value %q but got %v", "b", got)
+	}
+
+	h.Publish("t1", []byte("m1"))
+	h.Publish("t2", []byte("m2"))
+	if got := read(t, a); got != "m1" {
+		t.Errorf("expected a to read m1 but got %q", got)
+	}
+	if got := read(t, b) + read(t, b); got != "m1m2" {
+		t.Errorf("expected b to read m1 and m2 but got %q", got)
+	}
+	if got := read(t, c); got != "m2" {
+		t.Errorf("expected c to read m2 but got %q", got)
+	}
+
+	h.Unsubscribe(connB, "t1")
+	h.Subscribe(connB, "t3")
+	h.Send(connB, []byte("direct"))
+	h.Publish("t1", []byte("m3"))
+	h.Publish("t3", []byte("m4"))
+	if got := read(t, b) + read(t, b); got != "directm4" {
+		t.Errorf("expected b to read direct and m4 but got %q", got)
+	}
+	if got := read(t, a); got != "m3" {
+		t.Errorf("expected a to read m3 but got %q", got)
+	}
+}
+
+func TestClose(t *testing.T) {
+	closed := make(chan error, 2)
+	h := New(Config{OnClose: func(c *Conn, err error) { closed <- err }})
+	srv := newTestServer(t, h)
+
+	// Closed by the client.
+	client, conn := srv.dial(t, "topic=t1")
+	client.Close()
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected connection closed by the client to be done")
+	}
+	if err := <-closed; err == nil {
+		t.Error("expected the read error as close reason")
+	}
+
+	// Closed by the server.
+	client, conn = srv.dial(t, "topic=t1")
+	conn.Close()
+	conn.Close()
+	if err := <-closed; err != nil {
+		t.Errorf("expected no close reason but got: %v", err)
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := client.ReadMessage(); err == nil {
+		t.Error("expected the client to be disconnected")
+	}
+
+	if h.Count() != 0 || h.Len("t1") != 0 {
+		t.Errorf("expected no connections but got %d, %d in t1", h.Count(), h.Len("t1"))
+	}
+	if len(closed) != 0 {
+		t.Error("expected OnClose to be called once per connection")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	testCases := []struct {
+		policy  Policy
+		want    Outcome
+		wantErr error
+	}{
+		{policy: DropOldest, want: DroppedOldest},
+		{policy: Disconnect, want: Disconnected, wantErr: ErrQueueFull},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			var mu sync.Mutex
+			outcomes := map[Outcome]int{}
+			closed := make(chan error, 1)
+			h := New(Config{
+				QueueSize: 1,
+				Overflow:  tc.policy,
+				OnSend: func(c *Conn, o Outcome) {
+					mu.Lock()
+					outcomes[o]++
+					mu.Unlock()
+				},
+				OnClose: func(c *Conn, err error) { closed <- err },
+			})
+			srv := newTestServer(t, h)
+			// The client never reads, so the writes block
+			// once the socket buffers are full.
+			srv.dial(t, "topic=t1")
+
+			msg := make([]byte, 1<<20)
+			for i := 0; i < 32; i++ {
+				h.Publish("t1", msg)
+			}
+
+			mu.Lock()
+			got := outcomes[tc.want]
+			mu.Unlock()
+			if got == 0 {
+				t.Errorf("expected %s outcomes but got %v", tc.want, outcomes)
+			}
+			if tc.wantErr != nil {
+				select {
+				case err := <-closed:
+					if !errors.Is(err, tc.wantErr) {
+						t.Errorf("expected close reason %v but got: %v", tc.wantErr, err)
+					}
+				case <-time.After(5 * time.Second):
+					t.Error("expected the slow connection to be closed")
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	h := New(Config{QueueSize: 4})
+	srv := newTestServer(t, h)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?topic=t1,t2", nil)
+				if err != nil {
+					t.Errorf("expected no error connecting but got: %v", err)
+					return
+				}
+				conn := <-srv.conns
+				h.Subscribe(conn, "t3")
+				h.Publish("t3", []byte("m"))
+				h.Unsubscribe(conn, "t2")
+				_ = h.Topics(conn)
+				if j%2 == 0 {
+					conn.Close()
+				}
+				client.Close()
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Publish("t1", []byte("m"))
+				h.Len("t2")
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Count() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected all the connections to be unregistered but got %d", h.Count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, topic := range []string{"t1", "t2", "t3"} {
+		if n := h.Len(topic); n != 0 {
+			t.Errorf("expected topic %s to be empty but got %d", topic, n)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Message queues the commands can be consumed from.
+const (
+	IngestSourceNATS  = "nats"
+	IngestSourceKafka = "kafka"
+	IngestSourceSQS   = "sqs"
+)
+
+const (
+	// ingestKeyPrefix is the prefix of the Redis keys of the
+	// IDs of the commands being or already performed.
+	ingestKeyPrefix = "vulcan-stream:ingest:"
+
+	defIngestDedupTTL = 24 // hours
+	// ingestClaimLease is the time a command is claimed for while
+	// it is performed, so it can be performed again if the instance
+	// performing it stops before recording it.
+	ingestClaimLease = time.Minute
+)
+
+// ingestRetryInterval is the time to wait before consuming again
+// when the source fails, and before redelivering a failed command.
+var ingestRetryInterval = 5 * time.Second
+
+// ErrCommandInProgress is returned when claiming a command
+// that is being performed.
+var ErrCommandInProgress = errors.New("command in progress")
+
+// IngestConfig defines the message queue the abort and
+// control commands are consumed from.
+type IngestConfig struct {
+	// Source is the message queue: nats, kafka or sqs.
+	// Ingestion is disabled if empty.
+	Source string
+	// DedupTTL is the number of hours the IDs of the commands
+	// performed are remembered, so the redeliveries are ignored.
+	// Defaults to 24.
+	DedupTTL int
+
+	// NATSURL is the URL of the NATS server. The commands are
+	// consumed from the JetStream stream NATSStream, filtered by
+	// NATSSubject, through the durable consumer NATSConsumer.
+	NATSURL      string
+	NATSStream   string
+	NATSSubject  string
+	NATSConsumer string
+
+	// KafkaBrokers are the addresses of the Kafka brokers. The
+	// commands are consumed from KafkaTopic as the KafkaGroupID
+	// consumer group.
+	KafkaBrokers []string
+	KafkaTopic   string
+	KafkaGroupID string
+
+	// SQSQueueURL is the URL of the SQS queue. SQSEndpoint
+	// overrides the SQS endpoint, e.g. to use a local
+	// SQS-compatible queue.
+	SQSQueueURL string
+	SQSRegion   string
+	SQSEndpoint string
+}
+
+// Command is a command consumed from the message queue. Exactly
+// one of Abort and Message must be set.
+type Command struct {
+	// ID identifies the command, so it is performed
+	// once even if it is delivered more than once.
+	ID string `json:"id"`
+	// Abort aborts the checks, as a request to /abort.
+	Abort *AbortRequest `json:"abort,omitempty"`
+	// Message publishes a message, as a request to /messages.
+	Message *PublishRequest `json:"message,omitempty"`
+}
+
+// Source is a message queue the commands are consumed from.
+type Source interface {
+	// Consume calls handle with the data of every message received
+	// until ctx is done. A message is acknowledged if handle returns
+	// nil, and delivered again later otherwise.
+	Consume(ctx context.Context, handle func(ctx context.Context, data []byte) error) error
+	Close() error
+}
+
+// Deduper remembers the IDs of the commands performed.
+type Deduper interface {
+	// ClaimCommand claims id for lease, while the command is
+	// performed. It returns false if the command was already
+	// performed, and ErrCommandInProgress if it is claimed.
+	ClaimCommand(ctx context.Context, id string, lease time.Duration) (bool, error)
+	// CompleteCommand records id as performed for ttl.
+	CompleteCommand(ctx context.Context, id string, ttl time.Duration) error
+	// ReleaseCommand forgets id, so the command
+	// can be performed when delivered again.
+	ReleaseCommand(ctx context.Context, id string) error
+}
+
+// NewSource returns the message queue configured in c, or
+// nil if ingestion is disabled.
+func NewSource(ctx context.Context, c IngestConfig) (Source, error) {
+	switch c.Source {
+	case "":
+		return nil, nil
+	case IngestSourceNATS:
+		return newNATSSource(c)
+	case IngestSourceKafka:
+		return newKafkaSource(c), nil
+	case IngestSourceSQS:
+		return newSQSSource(ctx, c)
+	}
+	return nil, fmt.Errorf("unknown ingest source %q", c.Source)
+}
+
+// WithIngestion performs the commands consumed from source. The
+// commands are deduplicated by ID with dedup, for ttl, or for 24
+// hours if ttl is zero. The API consumes from source once started.
+func WithIngestion(source Source, name string, dedup Deduper, ttl time.Duration) APIOption {
+	return func(a *API) {
+		if ttl <= 0 {
+			ttl = defIngestDedupTTL * time.Hour
+		}
+		a.source = source
+		a.sourceName = name
+		a.dedup = dedup
+		a.dedupTTL = ttl
+	}
+}
+
+// Values of the Redis keys of the command IDs.
+const (
+	commandClaimed   = "claimed"
+	commandPerformed = "performed"
+)
+
+// claimCommandScript sets the key KEYS[1] to claimed for ARGV[1]
+// milliseconds if it doesn't exist, and returns its previous value.
+var claimCommandScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if v then
+	return v
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return ""
+`)
+
+// ClaimCommand claims the ID of a command for lease. It returns
+// false if the command was already performed, and
+// ErrCommandInProgress if it is claimed.
+func (r *RedisDB) ClaimCommand(ctx context.Context, id string, lease time.Duration) (ok bool, err error) {
+	defer func(start time.Time) { observeStorageOp("claim_command", start, err) }(time.Now())
+	v, err := claimCommandScript.Run(ctx, r.rdb, []string{ingestKeyPrefix + id}, commandClaimed, lease.Milliseconds()).Text()
+	if err != nil {
+		return false, err
+	}
+	switch v {
+	case "":
+		return true, nil
+	case commandClaimed:
+		return false, ErrCommandInProgress
+	}
+	return false, nil
+}
+
+// CompleteCommand records the ID of a command as performed for ttl.
+func (r *RedisDB) CompleteCommand(ctx context.Context, id string, ttl time.Duration) (err error) {
+	defer func(start time.Time) { observeStorageOp("complete_command", start, err) }(time.Now())
+	return r.rdb.Set(ctx, ingestKeyPrefix+id, commandPerformed, ttl).Err()
+}
+
+// ReleaseCommand forgets the ID of a command.
+func (r *RedisDB) ReleaseCommand(ctx context.Context, id string) (err error) {
+	defer func(start time.Time) { observeStorageOp("release_command", start, err) }(time.Now())
+	return r.rdb.Del(ctx, ingestKeyPrefix+id).Err()
+}
+
+// ingest consumes the commands from the source until ctx is
+// done, reconnecting if the source fails.
+func (a *API) ingest(ctx context.Context) {
+	logger := a.logger.WithField("source", a.sourceName)
+	logger.Info("Consuming commands")
+	for {
+		err := a.source.Consume(ctx, a.handleCommand)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.WithError(err).Error("Error consuming commands, retrying")
+		select {
+		case <-time.After(ingestRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleCommand performs the command in data. The ID of the command
+// is claimed for a short lease while it is performed, and recorded
+// as performed only once it succeeds, so the redeliveries of a
+// command performed are ignored and a command is never lost if it
+// fails or the instance stops before performing it. A command can
+// still be performed twice if it outlives its lease. The invalid
+// commands are dropped, as they would never succeed.
+func (a *API) handleCommand(ctx context.Context, data []byte) error {
+	var cmd Command
+	err := json.Unmarshal(data, &cmd)
+	if err == nil {
+		err = validateCommand(cmd)
+	}
+	if err != nil {
+		promIngested.WithLabelValues("invalid").Inc()
+		a.logger.WithError(err).WithField("command", string(data)).Error("Invalid command dropped")
+		return nil
+	}
+
+	logger := a.logger.WithFields(logrus.Fields{"command_id": cmd.ID, "source": a.sourceName})
+	ok, err := a.dedup.ClaimCommand(ctx, cmd.ID, ingestClaimLease)
+	if errors.Is(err, ErrCommandInProgress) {
+		promIngested.WithLabelValues("in_progress").Inc()
+		return fmt.Errorf("claiming command %s: %w", cmd.ID, err)
+	}
+	if err != nil {
+		promIngested.WithLabelValues("failed").Inc()
+		return fmt.Errorf("claiming command %s: %w", cmd.ID, err)
+	}
+	if !ok {
+		promIngested.WithLabelValues("duplicate").Inc()
+		logger.Info("Duplicate command ignored")
+		return nil
+	}
+
+	action, checks, scanID, err := a.performCommand(ctx, cmd)
+	a.recordIngestAudit(ctx, cmd.ID, action, checks, scanID, err)
+	switch {
+	case errors.As(err, &badRequest{}):
+		promIngested.WithLabelValues("invalid").Inc()
+		logger.WithError(err).Error("Invalid command dropped")
+		a.completeCommand(ctx, logger, cmd.ID)
+		return nil
+	case err != nil:
+		promIngested.WithLabelValues("failed").Inc()
+		if rerr := a.dedup.ReleaseCommand(ctx, cmd.ID); rerr != nil {
+			logger.WithError(rerr).Error("Error releasing failed command")
+		}
+		return fmt.Errorf("performing command %s: %w", cmd.ID, err)
+	}
+	promIngested.WithLabelValues("performed").Inc()
+	logger.WithField("action", action).Info("Command performed")
+	a.completeCommand(ctx, logger, cmd.ID)
+	return nil
+}
+
+// completeCommand records the command id as performed. The command
+// is acknowledged even if it can't be recorded, as it was performed.
+func (a *API) completeCommand(ctx context.Context, logger *logrus.Entry, id string) {
+	if err := a.dedup.CompleteCommand(ctx, id, a.dedupTTL); err != nil {
+		logger.WithError(err).Error("Error recording performed command")
+	}
+}
+
+// validateCommand checks the fields common to every command.
+func validateCommand(cmd Command) error {
+	switch {
+	case cmd.ID == "":
+		return errors.New("id is required")
+	case (cmd.Abort == nil) == (cmd.Message == nil):
+		return errors.New("exactly one of abort and message is required")
+	case cmd.Abort != nil && len(cmd.Abort.Checks) == 0:
+		return errors.New("abort.checks is required")
+	}
+	return nil
+}
+
+// performCommand performs cmd through the same path as the API
+// requests, and returns what was performed for the audit log.
+func (a *API) performCommand(ctx context.Context, cmd Command) (action string, checks []string, scanID string, err error) {
+	if cmd.Abort != nil {
+		scheduled, err := a.performAbort(ctx, cmd.Abort)
+		action = actionAbort
+		if scheduled != nil || (err != nil && !cmd.Abort.At.IsZero()) {
+			action = actionScheduleAbort
+		}
+		return action, cmd.Abort.Checks, cmd.Abort.ScanID, err
+	}
+	m := cmd.Message
+	if m.CheckID != "" {
+		checks = []string{m.CheckID}
+	}
+	return m.Action, checks, m.ScanID, a.performPublish(ctx, m)
+}
+
+// recordIngestAudit writes an audit entry for a command consumed
+// from the message queue, identified by the source and its ID.
+func (a *API) recordIngestAudit(ctx context.Context, id, action string, checks []string, scanID string, actionErr error) {
+	if a.audit == nil {
+		return
+	}
+	e := AuditEntry{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		Identity:  a.sourceName,
+		RequestID: id,
+		CheckIDs:  checks,
+		ScanID:    scanID,
+		Outcome:   auditOutcomeSuccess,
+	}
+	if actionErr != nil {
+		e.Outcome = auditOutcomeError
+		e.Error = actionErr.Error()
+	}
+	if err := a.audit.Record(ctx, e); err != nil {
+		a.logger.WithError(err).WithField("audit", e).Error("Unable to record audit entry")
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSource consumes the commands from a Kafka topic.
+type kafkaSource struct {
+	reader *kafka.Reader
+}
+
+func newKafkaSource(c IngestConfig) *kafkaSource {
+	return &kafkaSource{reader: kafka.NewReader(kafka.ReaderConfig{
+		Brokers: c.KafkaBrokers,
+		Topic:   c.KafkaTopic,
+		GroupID: c.KafkaGroupID,
+	})}
+}
+
+// Consume commits the offset of every message once handled. As the
+// messages of a partition are consumed in order, a message that
+// fails is retried until it succeeds, instead of skipping it.
+func (s *kafkaSource) Consume(ctx context.Context, handle func(ctx context.Context, data []byte) error) error {
+	for {
+		msg, err := s.reader.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+		for handle(ctx, msg.Value) != nil {
+			select {
+			case <-time.After(ingestRetryInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := s.reader.CommitMessages(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *kafkaSource) Close() error {
+	return s.reader.Close()
+}
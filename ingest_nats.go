@@ -0,0 +1,68 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsSource consumes the commands from a NATS JetStream stream.
+type natsSource struct {
+	conn *nats.Conn
+	cfg  IngestConfig
+}
+
+func newNATSSource(c IngestConfig) (*natsSource, error) {
+	conn, err := nats.Connect(c.NATSURL, nats.Name("vulcan-stream"))
+	if err != nil {
+		return nil, err
+	}
+	return &natsSource{conn: conn, cfg: c}, nil
+}
+
+// Consume consumes the messages through a durable consumer with
+// explicit acknowledgement, so the messages not acknowledged are
+// delivered again, after ingestRetryInterval if they failed.
+func (s *natsSource) Consume(ctx context.Context, handle func(ctx context.Context, data []byte) error) error {
+	js, err := jetstream.New(s.conn)
+	if err != nil {
+		return err
+	}
+	cons, err := js.CreateOrUpdateConsumer(ctx, s.cfg.NATSStream, jetstream.ConsumerConfig{
+		Durable:       s.cfg.NATSConsumer,
+		FilterSubject: s.cfg.NATSSubject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return err
+	}
+	it, err := cons.Messages()
+	if err != nil {
+		return err
+	}
+	defer it.Stop()
+
+	for {
+		msg, err := it.Next(jetstream.NextContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := handle(ctx, msg.Data()); err != nil {
+			msg.NakWithDelay(ingestRetryInterval)
+			continue
+		}
+		msg.Ack()
+	}
+}
+
+func (s *natsSource) Close() error {
+	return s.conn.Drain()
+}
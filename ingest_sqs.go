@@ -0,0 +1,72 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// sqsWaitTime is the number of seconds the
+// receive requests wait for messages.
+const sqsWaitTime = 20
+
+// sqsSource consumes the commands from an SQS queue.
+type sqsSource struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+func newSQSSource(ctx context.Context, c IngestConfig) (*sqsSource, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if c.SQSRegion != "" {
+		opts = append(opts, awsconfig.WithRegion(c.SQSRegion))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if c.SQSEndpoint != "" {
+			o.BaseEndpoint = aws.String(c.SQSEndpoint)
+		}
+	})
+	return &sqsSource{client: client, queueURL: c.SQSQueueURL}, nil
+}
+
+// Consume deletes every message once handled. The messages that
+// fail are left in the queue, to be received again once their
+// visibility timeout expires.
+func (s *sqsSource) Consume(ctx context.Context, handle func(ctx context.Context, data []byte) error) error {
+	for {
+		out, err := s.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(s.queueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     sqsWaitTime,
+		})
+		if err != nil {
+			return err
+		}
+		for _, msg := range out.Messages {
+			if handle(ctx, []byte(aws.ToString(msg.Body))) != nil {
+				continue
+			}
+			_, err := s.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(s.queueURL),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *sqsSource) Close() error {
+	return nil
+}
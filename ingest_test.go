@@ -0,0 +1,295 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	log "github.com/sirupsen/logrus"
+)
+
+// chanSource delivers the messages sent to it, redelivering
+// the ones not acknowledged, and records the acknowledged ones.
+type chanSource struct {
+	msgs  chan []byte
+	acked chan []byte
+}
+
+func (s *chanSource) Consume(ctx context.Context, handle func(ctx context.Context, data []byte) error) error {
+	for {
+		select {
+		case data := <-s.msgs:
+			if err := handle(ctx, data); err != nil {
+				s.msgs <- data
+				continue
+			}
+			s.acked <- data
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *chanSource) Close() error {
+	return nil
+}
+
+// memDedup keeps the command IDs in memory, mapped
+// to whether the command was performed.
+type memDedup struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func (d *memDedup) ClaimCommand(ctx context.Context, id string, lease time.Duration) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	performed, ok := d.ids[id]
+	if !ok {
+		d.ids[id] = false
+		return true, nil
+	}
+	if !performed {
+		return false, ErrCommandInProgress
+	}
+	return false, nil
+}
+
+func (d *memDedup) CompleteCommand(ctx context.Context, id string, ttl time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ids[id] = true
+	return nil
+}
+
+func (d *memDedup) ReleaseCommand(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.ids, id)
+	return nil
+}
+
+// flakyStorage fails to store the aborted checks the first time.
+type flakyStorage struct {
+	recordStorage
+	failed bool
+}
+
+func (s *flakyStorage) AddAbortedChecks(ctx context.Context, checks []string) error {
+	s.mu.Lock()
+	failed := s.failed
+	s.failed = true
+	s.mu.Unlock()
+	if !failed {
+		return errors.New("redis down")
+	}
+	return s.recordStorage.AddAbortedChecks(ctx, checks)
+}
+
+func TestIngest(t *testing.T) {
+	logger := log.New()
+	storage := &flakyStorage{}
+	source := &chanSource{msgs: make(chan []byte, 10), acked: make(chan []byte, 10)}
+	dedup := &memDedup{ids: make(map[string]bool)}
+	sender := NewSender(logger, SenderConfig{HTTPStream: "stream"})
+	api := NewAPI(0, sender, storage, logger, nopMetrics{},
+		WithActions([]string{"abort", "drain"}), WithIngestion(source, "test", dedup, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go api.ingest(ctx)
+
+	cmds := []string{
+		`{"id": "1", "abort": {"checks": ["c1", "c2"], "scan_id": "s1"}}`,
+		// Redelivered.
+		`{"id": "1", "abort": {"checks": ["c1", "c2"], "scan_id": "s1"}}`,
+		`{"id": "2", "message": {"action": "drain", "agent_id": "a1"}}`,
+		// Invalid commands are dropped.
+		`{"id": "3", "message": {"action": "shutdown"}}`,
+		`{"abort": {"checks": ["c3"]}}`,
+		`{"id": "4"`,
+	}
+	for _, c := range cmds {
+		source.msgs <- []byte(c)
+	}
+	for range cmds {
+		select {
+		case <-source.acked:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected every command to be acknowledged")
+		}
+	}
+
+	// The first abort failed, was released and performed when redelivered.
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if got := strings.Join(storage.checks, ","); got != "c1,c2" {
+		t.Errorf("expected checks c1,c2 aborted once but got %v", got)
+	}
+}
+
+func TestIngestNATS(t *testing.T) {
+	defer func(d time.Duration) { ingestRetryInterval = d }(ingestRetryInterval)
+	ingestRetryInterval = 100 * time.Millisecond
+
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("expected no error creating NATS server but got: %v", err)
+	}
+	srv.Start()
+	defer srv.Shutdown()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("expected NATS server to be ready")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("expected no error connecting to NATS but got: %v", err)
+	}
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatalf("expected no error creating JetStream context but got: %v", err)
+	}
+	stream, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "commands", Subjects: []string{"commands.>"}})
+	if err != nil {
+		t.Fatalf("expected no error creating stream but got: %v", err)
+	}
+
+	cfg := IngestConfig{
+		Source:       IngestSourceNATS,
+		NATSURL:      srv.ClientURL(),
+		NATSStream:   "commands",
+		NATSSubject:  "commands.>",
+		NATSConsumer: "vulcan-stream",
+	}
+	source, err := NewSource(ctx, cfg)
+	if err != nil {
+		t.Fatalf("expected no error connecting the source but got: %v", err)
+	}
+	defer source.Close()
+
+	storage := &flakyStorage{}
+	sender := NewSender(log.New(), SenderConfig{HTTPStream: "stream"})
+	api := NewAPI(0, sender, storage, log.New(), nopMetrics{},
+		WithIngestion(source, cfg.Source, &memDedup{ids: make(map[string]bool)}, 0))
+	go api.ingest(ctx)
+
+	cmds := []string{
+		`{"id": "1", "abort": {"checks": ["c1", "c2"], "scan_id": "s1"}}`,
+		`{"id": "1", "abort": {"checks": ["c1", "c2"], "scan_id": "s1"}}`,
+	}
+	for _, c := range cmds {
+		if _, err := js.Publish(ctx, "commands.abort", []byte(c)); err != nil {
+			t.Fatalf("expected no error publishing command but got: %v", err)
+		}
+	}
+
+	// The first abort fails, is not acknowledged and is
+	// delivered again. The duplicate is acknowledged.
+	cons, err := stream.Consumer(ctx, cfg.NATSConsumer)
+	if err != nil {
+		t.Fatalf("expected no error getting consumer but got: %v", err)
+	}
+	for {
+		info, err := cons.Info(ctx)
+		if err != nil {
+			t.Fatalf("expected no error getting consumer info but got: %v", err)
+		}
+		if info.AckFloor.Stream == uint64(len(cmds)) {
+			if info.NumRedelivered == 0 && info.Delivered.Consumer <= uint64(len(cmds)) {
+				t.Errorf("expected the failed command to be redelivered but got: %+v", info.Delivered)
+			}
+			break
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatalf("expected every command to be acknowledged but got ack floor %+v", info.AckFloor)
+		}
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if got := strings.Join(storage.checks, ","); got != "c1,c2" {
+		t.Errorf("expected checks c1,c2 aborted once but got %v", got)
+	}
+}
+
+func TestRedisDedup(t *testing.T) {
+	mr := miniredis.RunT(t)
+	port, _ := strconv.Atoi(mr.Port())
+	db, err := NewRedisDB(RedisConfig{Host: mr.Host(), Port: port})
+	if err != nil {
+		t.Fatalf("expected no error connecting to redis but got: %v", err)
+	}
+	ctx := context.Background()
+
+	ok, err := db.ClaimCommand(ctx, "1", time.Minute)
+	if !ok || err != nil {
+		t.Fatalf("expected command claimed but got %v, %v", ok, err)
+	}
+	if _, err := db.ClaimCommand(ctx, "1", time.Minute); !errors.Is(err, ErrCommandInProgress) {
+		t.Errorf("expected command in progress but got: %v", err)
+	}
+
+	// The claim of a command not completed expires.
+	mr.FastForward(2 * time.Minute)
+	if ok, err := db.ClaimCommand(ctx, "1", time.Minute); !ok || err != nil {
+		t.Fatalf("expected expired claim claimed again but got %v, %v", ok, err)
+	}
+	if err := db.CompleteCommand(ctx, "1", time.Hour); err != nil {
+		t.Fatalf("expected no error completing command but got: %v", err)
+	}
+	mr.FastForward(2 * time.Minute)
+	if ok, err := db.ClaimCommand(ctx, "1", time.Minute); ok || err != nil {
+		t.Errorf("expected performed command not claimed but got %v, %v", ok, err)
+	}
+
+	// A released command can be claimed again.
+	if ok, err := db.ClaimCommand(ctx, "2", time.Minute); !ok || err != nil {
+		t.Fatalf("expected command claimed but got %v, %v", ok, err)
+	}
+	if err := db.ReleaseCommand(ctx, "2"); err != nil {
+		t.Fatalf("expected no error releasing command but got: %v", err)
+	}
+	if ok, err := db.ClaimCommand(ctx, "2", time.Minute); !ok || err != nil {
+		t.Errorf("expected released command claimed but got %v, %v", ok, err)
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cmd     Command
+		wantErr bool
+	}{
+		{name: "Abort", cmd: Command{ID: "1", Abort: &AbortRequest{Checks: []string{"c1"}}}},
+		{name: "Message", cmd: Command{ID: "1", Message: &PublishRequest{}}},
+		{name: "Without ID", cmd: Command{Abort: &AbortRequest{Checks: []string{"c1"}}}, wantErr: true},
+		{name: "Empty", cmd: Command{ID: "1"}, wantErr: true},
+		{name: "Both", cmd: Command{ID: "1", Abort: &AbortRequest{Checks: []string{"c1"}}, Message: &PublishRequest{}}, wantErr: true},
+		{name: "Abort without checks", cmd: Command{ID: "1", Abort: &AbortRequest{}}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateCommand(tc.cmd); (err != nil) != tc.wantErr {
+				t.Errorf("expected error %v but got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
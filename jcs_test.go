@@ -0,0 +1,68 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	// The cases are taken from the examples in RFC 8785.
+	testCases := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "Numbers",
+			data: `[333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001, -0, 1e21, 1e-7, 100]`,
+			want: `[333333333.3333333,1e+30,4.5,0.002,1e-27,0,1e+21,1e-7,100]`,
+		},
+		{
+			name: "Strings",
+			data: `["\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/", "<a & b>"]`,
+			want: "[\"\u20ac$\\u000f\\nA'B\\\"\\\\\\\\\\\"/\",\"<a & b>\"]",
+		},
+		{
+			name: "Literals",
+			data: `{"b": [true, false, null], "a": {}}`,
+			want: `{"a":{},"b":[true,false,null]}`,
+		},
+		{
+			name: "Sorting",
+			data: `{
+				"\u20ac": "Euro Sign",
+				"\r": "Carriage Return",
+				"\ufb33": "Hebrew Letter Dalet With Dagesh",
+				"1": "One",
+				"\ud83d\ude00": "Emoji: Grinning Face",
+				"\u0080": "Control",
+				"\u00f6": "Latin Small Letter O With Diaeresis"
+			}`,
+			want: "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\"," +
+				"\"\u20ac\":\"Euro Sign\",\"\U0001F600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := json.NewDecoder(bytes.NewReader([]byte(tc.data)))
+			dec.UseNumber()
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				t.Fatalf("expected no error decoding JSON but got: %v", err)
+			}
+			got, err := canonicalJSON(v)
+			if err != nil {
+				t.Fatalf("expected no error canonicalizing JSON but got: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("expected canonical form:\n%s\nbut got:\n%s", tc.want, got)
+			}
+		})
+	}
+}
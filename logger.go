@@ -5,54 +5,214 @@ Copyright 2019 Adevinta
 package stream
 
 import (
-	"os"
+	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// LogFormatText writes the logs as logfmt like text lines.
+	LogFormatText = "text"
+	// LogFormatJSON writes the logs as JSON objects, one per line.
+	LogFormatJSON = "json"
+
+	// noSizeRotation is the max size, in megabytes, used when the log
+	// file must not be rotated by size. lumberjack always rotates by
+	// size, so a size that is never reached in practice is used.
+	noSizeRotation = 1 << 30
 )
 
 // LoggerConfig defines required Vulcan Logger configuration.
 type LoggerConfig struct {
 	LogFile  string
 	LogLevel string
+	// Format is either text, the default, or json.
+	Format string
+	// MaxSize is the size in megabytes the log file can reach
+	// before being rotated. Zero disables size based rotation.
+	MaxSize int
+	// RotateInterval is the number of hours after which the log
+	// file is rotated. Zero disables time based rotation.
+	RotateInterval int
+	// MaxAge is the number of days the rotated log files are kept.
+	// Zero keeps them regardless of their age.
+	MaxAge int
+	// MaxBackups is the number of rotated log files that are kept.
+	// Zero keeps all of them.
+	MaxBackups int
+	// Compress gzips the rotated log files.
+	Compress bool
 }
 
-// NewLogger provides a logrus FieldLogger.
-func NewLogger(lc LoggerConfig) (logrus.FieldLogger, *os.File, error) {
+// LogFile is the file the logs are written to. It is rotated
+// according to the LoggerConfig it was created with.
+// A nil LogFile is valid and does nothing.
+type LogFile struct {
+	*lumberjack.Logger
+	stop chan struct{}
+}
+
+// Reopen closes the log file, so it is opened again on the next write.
+// It allows external tools like logrotate to move the file away.
+func (f *LogFile) Reopen() error {
+	if f == nil {
+		return nil
+	}
+	return f.Logger.Close()
+}
+
+// Close stops rotating the log file and closes it.
+func (f *LogFile) Close() error {
+	if f == nil {
+		return nil
+	}
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+	return f.Logger.Close()
+}
+
+// rotateEvery rotates the log file at the given interval until it is closed.
+func (f *LogFile) rotateEvery(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// The error can't be logged to the file that failed to
+			// rotate, and lumberjack keeps writing to the current one.
+			_ = f.Rotate()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// NewLogger provides a logrus FieldLogger. If lc.LogFile is set, the
+// logs are written to the returned LogFile, which must be closed by
+// the caller. Otherwise, the logs are written to stderr and the
+// returned LogFile is nil.
+func NewLogger(lc LoggerConfig) (logrus.FieldLogger, *LogFile, error) {
 	logger := logrus.New().WithFields(logrus.Fields{
 		"app": "VULCAN-STREAM",
 	})
-	logger.Logger.Formatter = &logrus.TextFormatter{
-		FullTimestamp: true,
-		DisableColors: true,
-	}
 
-	var file *os.File
-	var err error
+	formatter, err := newFormatter(lc.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.Logger.Formatter = formatter
 
+	var file *LogFile
 	if lc.LogFile != "" {
-		file, err = os.OpenFile(lc.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
-		if err != nil {
+		maxSize := lc.MaxSize
+		if maxSize <= 0 {
+			maxSize = noSizeRotation
+		}
+		file = &LogFile{
+			Logger: &lumberjack.Logger{
+				Filename:   lc.LogFile,
+				MaxSize:    maxSize,
+				MaxAge:     lc.MaxAge,
+				MaxBackups: lc.MaxBackups,
+				LocalTime:  true,
+				Compress:   lc.Compress,
+			},
+		}
+		// Open the file now, so an unwritable
+		// file is reported at start up.
+		if _, err := file.Write(nil); err != nil {
 			return nil, nil, err
 		}
+		if lc.RotateInterval > 0 {
+			file.stop = make(chan struct{})
+			go file.rotateEvery(time.Duration(lc.RotateInterval) * time.Hour)
+		}
 		logger.Logger.Out = file
 	}
 
-	switch lc.LogLevel {
+	level, err := ParseLogLevel(lc.LogLevel)
+	if err != nil {
+		level = logrus.DebugLevel
+	}
+	logger.Logger.Level = level
+
+	return logger, file, nil
+}
+
+// newFormatter returns the logrus formatter for the given config log format.
+func newFormatter(format string) (logrus.Formatter, error) {
+	switch strings.ToLower(format) {
+	case "", LogFormatText:
+		return &logrus.TextFormatter{
+			FullTimestamp: true,
+			DisableColors: true,
+		}, nil
+	case LogFormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, valid formats are %s and %s", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// ValidateLogFormat checks that format is a valid config log format.
+func ValidateLogFormat(format string) error {
+	_, err := newFormatter(format)
+	return err
+}
+
+// ParseLogLevel returns the logrus level for the given
+// config log level, which is not case sensitive.
+func ParseLogLevel(level string) (logrus.Level, error) {
+	switch strings.ToUpper(level) {
 	case "DEBUG":
-		logger.Logger.Level = logrus.DebugLevel
+		return logrus.DebugLevel, nil
 	case "INFO":
-		logger.Logger.Level = logrus.InfoLevel
+		return logrus.InfoLevel, nil
 	case "WARN":
-		logger.Logger.Level = logrus.WarnLevel
+		return logrus.WarnLevel, nil
 	case "ERROR":
-		logger.Logger.Level = logrus.ErrorLevel
+		return logrus.ErrorLevel, nil
 	case "FATAL":
-		logger.Logger.Level = logrus.FatalLevel
+		return logrus.FatalLevel, nil
 	case "PANIC":
-		logger.Logger.Level = logrus.PanicLevel
+		return logrus.PanicLevel, nil
 	default:
-		logger.Logger.Level = logrus.DebugLevel
+		return 0, fmt.Errorf("unknown log level %q, valid levels are DEBUG, INFO, WARN, ERROR, FATAL and PANIC", level)
 	}
+}
 
-	return logger, file, nil
+// SetLogLevel changes the level of a logger built by NewLogger.
+func SetLogLevel(logger logrus.FieldLogger, level string) error {
+	lvl, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	entry, ok := logger.(*logrus.Entry)
+	if !ok {
+		return fmt.Errorf("unsupported logger type %T", logger)
+	}
+	entry.Logger.SetLevel(lvl)
+	return nil
+}
+
+type loggerKey struct{}
+
+// withLogger returns a copy of ctx carrying the given logger.
+func withLogger(ctx context.Context, logger logrus.FieldLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the logger carried by ctx, which includes
+// the fields of the request being served, or def if there is none.
+func loggerFrom(ctx context.Context, def logrus.FieldLogger) logrus.FieldLogger {
+	if l, ok := ctx.Value(loggerKey{}).(logrus.FieldLogger); ok {
+		return l
+	}
+	return def
 }
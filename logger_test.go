@@ -5,11 +5,19 @@ Copyright 2019 Adevinta
 package stream
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/sirupsen/logrus"
 )
 
 func TestNewLogger(t *testing.T) {
-	lc := LoggerConfig{LogFile: "logfile", LogLevel: "INFO"}
+	lc := LoggerConfig{LogFile: filepath.Join(t.TempDir(), "logfile"), LogLevel: "INFO"}
 	logger, logFile, err := NewLogger(lc)
 
 	if logger == nil {
@@ -24,3 +32,72 @@ func TestNewLogger(t *testing.T) {
 		t.Errorf("error while creating new logger: %s", err)
 	}
 }
+
+func TestSetLogLevel(t *testing.T) {
+	logger, _, err := NewLogger(LoggerConfig{LogLevel: "INFO"})
+	if err != nil {
+		t.Fatalf("error while creating new logger: %s", err)
+	}
+
+	if err := SetLogLevel(logger, "error"); err != nil {
+		t.Fatalf("error while setting log level: %s", err)
+	}
+	if lvl := logger.(*logrus.Entry).Logger.GetLevel(); lvl != logrus.ErrorLevel {
+		t.Errorf("expected level %s but got %s", logrus.ErrorLevel, lvl)
+	}
+
+	if err := SetLogLevel(logger, "verbose"); err == nil {
+		t.Errorf("expected error setting unknown log level")
+	}
+}
+
+func TestJSONLogsWithRequestID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.log")
+	logger, logFile, err := NewLogger(LoggerConfig{LogFile: path, LogLevel: "INFO", Format: "json"})
+	if err != nil {
+		t.Fatalf("error while creating new logger: %s", err)
+	}
+	defer logFile.Close()
+
+	a := &API{logger: logger}
+	h := a.withRequestID(func(w http.ResponseWriter, r *http.Request) {
+		loggerFrom(r.Context(), logger).Info("handled")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/checks", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if got := rec.Header().Get(requestIDHeader); got != "req-1" {
+		t.Errorf("expected request ID header %q but got %q", "req-1", got)
+	}
+
+	// Move the file away as logrotate does and reopen it.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("error renaming log file: %s", err)
+	}
+	if err := logFile.Reopen(); err != nil {
+		t.Fatalf("error reopening log file: %s", err)
+	}
+	logger.Info("reopened")
+
+	rotated, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatalf("error reading rotated log file: %s", err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(rotated, &entry); err != nil {
+		t.Fatalf("log line is not JSON: %s", err)
+	}
+	if entry["request_id"] != "req-1" || entry["msg"] != "handled" {
+		t.Errorf("unexpected log entry %v", entry)
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading reopened log file: %s", err)
+	}
+	if !strings.Contains(string(current), `"msg":"reopened"`) {
+		t.Errorf("expected reopened log file to contain the new entries, got %q", current)
+	}
+}
@@ -4,10 +4,74 @@ Copyright 2019 Adevinta
 
 package stream
 
-// Message describes a stream message
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// MessageVersion is the version of the message format. It is increased
+// when the format changes in a way the agents must be aware of.
+const MessageVersion = 1
+
+// MessageSchema is the JSON Schema of the messages sent to the stream.
+//
+//go:embed schema/message.schema.json
+var MessageSchema []byte
+
+// Message describes a stream message. The envelope fields, ID,
+// CreatedAt and Version, are set when the message is published.
+// They are added next to the original fields, so the agents
+// unaware of them keep working.
 type Message struct {
 	CheckID string `json:"check_id,omitempty"`
 	AgentID string `json:"agent_id,omitempty"`
 	ScanID  string `json:"scan_id,omitempty"`
 	Action  string `json:"action"`
+	// TraceParent is the W3C trace-context of the operation that
+	// produced the message, so agents can continue the trace.
+	TraceParent string `json:"traceparent,omitempty"`
+
+	// ID identifies the message, so agents can deduplicate it.
+	ID string `json:"id,omitempty"`
+	// CreatedAt is the time the message was published.
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	// Version is the MessageVersion of the message format.
+	Version int `json:"version,omitempty"`
+	// Payload holds the data specific to the action, if any.
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// KeyID and Sig are set when the message is signed.
+	// See Keyring.Sign and Verify.
+	KeyID string `json:"kid,omitempty"`
+	Sig   string `json:"sig,omitempty"`
+}
+
+// String returns the JSON representation of the message.
+func (m Message) String() string {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// stamp returns msg with the envelope fields set. The ID and
+// the creation time are kept if they were already set.
+func stamp(msg Message) Message {
+	if msg.ID == "" {
+		msg.ID = newUUID()
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	msg.Version = MessageVersion
+	return msg
+}
+
+// schemaHandler returns the JSON Schema of the stream messages.
+func (a *API) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(MessageSchema)
 }
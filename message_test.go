@@ -0,0 +1,90 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMessageEnvelope(t *testing.T) {
+	s := NewSender(log.New(), SenderConfig{HTTPStream: "stream"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.HandleConn(w, r)
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("expected no error connecting but got: %v", err)
+	}
+	defer conn.Close()
+	waitSubscribers(t, s, 1)
+
+	before := time.Now().UTC()
+	s.Broadcast(context.Background(), Message{CheckID: "c1", Action: actionAbort, Payload: json.RawMessage(`{"reason":"timeout"}`)})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, raw, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("expected no error reading message but got: %v", err)
+	}
+
+	var m Message
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatalf("expected no error decoding message but got: %v", err)
+	}
+	if m.ID == "" || m.Version != MessageVersion || m.CreatedAt.Before(before) {
+		t.Errorf("unexpected envelope fields in %s", raw)
+	}
+	if string(m.Payload) != `{"reason":"timeout"}` {
+		t.Errorf("unexpected payload in %s", raw)
+	}
+
+	// The agents unaware of the envelope still get the original fields.
+	var legacy struct {
+		CheckID string `json:"check_id"`
+		Action  string `json:"action"`
+	}
+	if err := json.Unmarshal(raw, &legacy); err != nil || legacy.CheckID != "c1" || legacy.Action != actionAbort {
+		t.Errorf("expected legacy fields in %s, error: %v", raw, err)
+	}
+}
+
+func TestMessageSchema(t *testing.T) {
+	logger := log.New()
+	api := NewAPI(0, NewSender(logger, SenderConfig{}), mockStorage{}, logger, nil)
+
+	rec := httptest.NewRecorder()
+	api.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schema/message.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d but got %d", http.StatusOK, rec.Code)
+	}
+
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("expected schema to be JSON but got: %v", err)
+	}
+
+	// Every field of Message must be described by the schema.
+	typ := reflect.TypeOf(Message{})
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("expected schema to describe the %q field", name)
+		}
+	}
+}
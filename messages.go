@@ -0,0 +1,111 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// actionPing is the action of the messages the sender
+// publishes periodically, which can't be published
+// through the API.
+const actionPing = "ping"
+
+// PublishRequest represents the body of a request to publish
+// a message to the stream.
+type PublishRequest struct {
+	Message
+	// Topic is the stream topic the message is
+	// published to. Defaults to the default topic.
+	Topic string `json:"topic,omitempty"`
+}
+
+// WithActions sets the actions of the messages that can be
+// published through the /messages endpoint. By default, only
+// abort messages can be published.
+func WithActions(actions []string) APIOption {
+	return func(a *API) {
+		a.actions = make(map[string]bool)
+		for _, action := range actions {
+			a.actions[action] = true
+		}
+	}
+}
+
+// messagesHandler publishes the message in the request body to the
+// stream. The checks of the abort messages are stored as aborted.
+func (a *API) messagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// As with the aborts, do not stop publishing
+	// the message if the caller goes away.
+	ctx := context.WithoutCancel(r.Context())
+
+	var req PublishRequest
+	err := a.publish(ctx, r, &req)
+	var checks []string
+	if req.CheckID != "" {
+		checks = []string{req.CheckID}
+	}
+	a.recordAudit(r, req.Action, checks, req.ScanID, err)
+	if err != nil {
+		a.writeErr(w, r, err)
+	}
+}
+
+// publish reads the publish request from r into req,
+// validates it and dispatches the message.
+func (a *API) publish(ctx context.Context, r *http.Request, req *PublishRequest) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		return badRequest{err}
+	}
+	return a.performPublish(ctx, req)
+}
+
+// performPublish validates the message in req and dispatches it.
+func (a *API) performPublish(ctx context.Context, req *PublishRequest) error {
+	topic, err := a.topic(req.Topic)
+	if err != nil {
+		return err
+	}
+	if err := a.validateMessage(req.Message); err != nil {
+		return badRequest{err}
+	}
+
+	return a.dispatch(ctx, topic, []Message{req.Message})
+}
+
+// validateMessage checks that m can be published through the API.
+func (a *API) validateMessage(m Message) error {
+	switch {
+	case m.Action == "":
+		return errors.New("action is required")
+	case m.Action == actionPing:
+		return fmt.Errorf("action %q is reserved", actionPing)
+	case !a.actions[m.Action]:
+		return fmt.Errorf("action %q is not allowed", m.Action)
+	case m.Action == actionAbort && m.CheckID == "":
+		return fmt.Errorf("check_id is required for action %q", actionAbort)
+	case m.TraceParent != "":
+		return errors.New("traceparent is set by the stream, use the traceparent header instead")
+	case m.Version != 0 || !m.CreatedAt.IsZero():
+		return errors.New("version and created_at are set by the stream")
+	case m.KeyID != "" || m.Sig != "":
+		return errors.New("kid and sig are set by the stream")
+	}
+	return nil
+}
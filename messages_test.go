@@ -0,0 +1,107 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// recordStorage records the checks added as aborted.
+type recordStorage struct {
+	mockStorage
+	mu     sync.Mutex
+	checks []string
+}
+
+func (s *recordStorage) AddAbortedChecks(ctx context.Context, checks []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, checks...)
+	return nil
+}
+
+func TestMessagesHandler(t *testing.T) {
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		wantCode   int
+		wantStored []string
+	}{
+		{
+			name:       "Abort",
+			method:     http.MethodPost,
+			body:       `{"action": "abort", "check_id": "c1", "scan_id": "s1"}`,
+			wantCode:   http.StatusOK,
+			wantStored: []string{"c1"},
+		},
+		{
+			name:     "Allowed action to topic",
+			method:   http.MethodPost,
+			body:     `{"action": "drain", "agent_id": "a1", "topic": "agent-control"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Action not allowed",
+			method:   http.MethodPost,
+			body:     `{"action": "shutdown"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Ping",
+			method:   http.MethodPost,
+			body:     `{"action": "ping"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Abort without check",
+			method:   http.MethodPost,
+			body:     `{"action": "abort"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Unknown topic",
+			method:   http.MethodPost,
+			body:     `{"action": "drain", "topic": "unknown"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Invalid JSON",
+			method:   http.MethodPost,
+			body:     `{"action":`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Not POST",
+			method:   http.MethodGet,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	logger := log.New()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := &recordStorage{}
+			sender := NewSender(logger, SenderConfig{HTTPStream: "stream", Topics: []string{"agent-control"}})
+			api := NewAPI(0, sender, storage, logger, nopMetrics{}, WithActions([]string{"abort", "drain", "ping"}))
+
+			rec := httptest.NewRecorder()
+			api.mux.ServeHTTP(rec, httptest.NewRequest(tc.method, "/messages", strings.NewReader(tc.body)))
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected status code %d but got %d: %s", tc.wantCode, rec.Code, rec.Body)
+			}
+			if strings.Join(storage.checks, ",") != strings.Join(tc.wantStored, ",") {
+				t.Errorf("expected stored checks %v but got %v", tc.wantStored, storage.checks)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	promNamespace = "vulcan_stream"
+
+	defPrometheusPath = "/metrics"
+)
+
+// MetricsConfig defines the metrics configuration.
+type MetricsConfig struct {
+	// Enabled enables pushing metrics to DogStatsD.
+	Enabled bool `toml:"enabled"`
+	// Prometheus enables the Prometheus exposition endpoint.
+	Prometheus bool
+	// PrometheusPath is the path the Prometheus endpoint is served at.
+	// Defaults to /metrics.
+	PrometheusPath string
+}
+
+var (
+	promRegistry = prometheus.NewRegistry()
+
+	promAPIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: promNamespace,
+		Subsystem: "api",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the API requests by route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	promSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Subsystem: "sender",
+		Name:      "subscribers",
+		Help:      "Number of websocket subscribers currently connected to the stream.",
+	})
+
+	promBroadcastDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: promNamespace,
+		Subsystem: "sender",
+		Name:      "broadcast_duration_seconds",
+		Help:      "Time spent fanning out a message to the stream subscribers.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"action"})
+
+	promSendOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Subsystem: "sender",
+		Name:      "messages_total",
+		Help:      "Number of messages sent to the subscribers by outcome: queued, dropped_oldest, disconnected or write_error.",
+	}, []string{"outcome"})
+
+	promStorageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: promNamespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of the remote storage operations by operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op", "result"})
+
+	promCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Subsystem: "storage",
+		Name:      "cache_size",
+		Help:      "Number of aborted checks held in the local cache.",
+	})
+
+	promDegraded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Subsystem: "storage",
+		Name:      "degraded",
+		Help:      "Whether the storage is running in degraded mode (1) or not (0).",
+	})
+
+	promPendingWrites = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: promNamespace,
+		Subsystem: "storage",
+		Name:      "pending_writes",
+		Help:      "Number of checks queued to be written to the remote DB.",
+	})
+
+	promCompressedMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Subsystem: "sender",
+		Name:      "compressed_messages_total",
+		Help:      "Number of messages sent compressed to the subscribers.",
+	})
+
+	promCompressionSaved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Subsystem: "sender",
+		Name:      "compression_saved_bytes_total",
+		Help:      "Number of bytes saved by compressing the messages sent to the subscribers.",
+	})
+
+	promWebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Subsystem: "webhook",
+		Name:      "deliveries_total",
+		Help:      "Number of webhook deliveries by webhook and outcome: delivered, retried, dead_lettered or dropped.",
+	}, []string{"webhook", "outcome"})
+
+	promIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Subsystem: "ingest",
+		Name:      "commands_total",
+		Help:      "Number of commands consumed from the message queue by outcome: performed, duplicate, in_progress, invalid or failed.",
+	}, []string{"outcome"})
+
+	promBridged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Subsystem: "bridge",
+		Name:      "messages_total",
+		Help:      "Number of messages mirrored to the event bus by outcome: sent, retried or dropped.",
+	}, []string{"outcome"})
+
+	promLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: promNamespace,
+		Subsystem: "api",
+		Name:      "limited_total",
+		Help:      "Number of requests and subscribers rejected by limit.",
+	}, []string{"limit"})
+)
+
+func init() {
+	promRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		promAPIRequestDuration,
+		promSubscribers,
+		promBroadcastDuration,
+		promSendOutcomes,
+		promCompressedMessages,
+		promCompressionSaved,
+		promWebhookDeliveries,
+		promIngested,
+		promBridged,
+		promStorageDuration,
+		promCacheSize,
+		promDegraded,
+		promPendingWrites,
+		promLimited,
+	)
+}
+
+// PrometheusHandler returns an HTTP handler exposing the stream
+// metrics in the Prometheus exposition format.
+func PrometheusHandler() http.Handler {
+	return promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{})
+}
+
+// observeStorageOp records the duration of a remote storage operation
+// started at start.
+func observeStorageOp(op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	promStorageDuration.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+}
+
+// instrument wraps h so the duration of every request is recorded
+// under the given route label.
+func instrument(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+		promAPIRequestDuration.WithLabelValues(route, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// statusRecorder is an http.ResponseWriter that keeps
+// track of the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// onHijack wraps w so opened is called when the connection is hijacked
+// for a websocket and closed is called once when the hijacked
+// connection is closed.
+func onHijack(w http.ResponseWriter, opened, closed func()) *hijackWriter {
+	return &hijackWriter{ResponseWriter: w, opened: opened, closed: closed}
+}
+
+type hijackWriter struct {
+	http.ResponseWriter
+	opened, closed func()
+	hijacked       bool
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	w.opened()
+	return &hijackedConn{Conn: conn, closed: w.closed}, rw, nil
+}
+
+type hijackedConn struct {
+	net.Conn
+	closed func()
+	once   sync.Once
+}
+
+func (c *hijackedConn) Close() error {
+	c.once.Do(c.closed)
+	return c.Conn.Close()
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrument(t *testing.T) {
+	h := instrument("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := `vulcan_stream_api_request_duration_seconds_count{route="/test",status="418"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("expected %q in output:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	promCacheSize.Set(3)
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "vulcan_stream_storage_cache_size 3") {
+		t.Fatalf("expected cache size metric in output:\n%s", rec.Body.String())
+	}
+}
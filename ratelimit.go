@@ -0,0 +1,248 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// limit names used as metric labels.
+	limitRate           = "rate"
+	limitSubscribers    = "subscribers"
+	limitSubscribersAgt = "subscribers_agent"
+	limitSubscribersIP  = "subscribers_ip"
+
+	// sweepInterval is how often the idle
+	// client buckets are removed.
+	sweepInterval = time.Minute
+)
+
+// RateLimitConfig defines the limits applied to the API clients.
+// A zero value disables the corresponding limit.
+type RateLimitConfig struct {
+	// Rate is the number of requests per second each client can make
+	// to the API, excluding the stream, health and metrics endpoints.
+	Rate float64
+	// Burst is the number of requests a client can make at once.
+	// Defaults to the rate rounded up.
+	Burst int
+	// MaxSubscribers is the maximum number of concurrent stream subscribers.
+	MaxSubscribers int
+	// MaxSubscribersPerAgent is the maximum number of concurrent
+	// stream subscribers with the same agent ID.
+	MaxSubscribersPerAgent int
+	// MaxSubscribersPerIP is the maximum number of concurrent
+	// stream subscribers from the same IP address.
+	MaxSubscribersPerIP int
+	// ClientIPHeader is the request header the client IP address is
+	// read from, e.g. X-Forwarded-For when running behind a proxy.
+	// If the header has several addresses, the last one is used, as
+	// it is the one appended by the proxy and can not be spoofed.
+	ClientIPHeader string
+}
+
+// WithRateLimit applies the limits in c to the API clients.
+func WithRateLimit(c RateLimitConfig) APIOption {
+	return func(a *API) {
+		a.clientIPHeader = c.ClientIPHeader
+		if c.Rate > 0 {
+			a.limiter = newClientLimiter(c.Rate, c.Burst)
+		}
+		if c.MaxSubscribers > 0 || c.MaxSubscribersPerAgent > 0 || c.MaxSubscribersPerIP > 0 {
+			a.subscribers = &subscriberLimits{
+				max:      c.MaxSubscribers,
+				perAgent: c.MaxSubscribersPerAgent,
+				perIP:    c.MaxSubscribersPerIP,
+				agents:   make(map[string]int),
+				ips:      make(map[string]int),
+			}
+		}
+	}
+}
+
+// clientLimiter keeps a token bucket per client.
+type clientLimiter struct {
+	mu        sync.Mutex
+	rate      rate.Limit
+	burst     int
+	idle      time.Duration
+	clients   map[string]*clientBucket
+	lastSweep time.Time
+}
+
+type clientBucket struct {
+	limiter *rate.Limiter
+	last    time.Time
+}
+
+func newClientLimiter(r float64, burst int) *clientLimiter {
+	if burst <= 0 {
+		burst = int(r)
+		if float64(burst) < r {
+			burst++
+		}
+	}
+	// A bucket idle for the time it takes to refill it
+	// is full, so it can be dropped and created again.
+	idle := time.Duration(float64(burst) / r * float64(time.Second))
+	if idle < sweepInterval {
+		idle = sweepInterval
+	}
+	return &clientLimiter{
+		rate:      rate.Limit(r),
+		burst:     burst,
+		idle:      idle,
+		clients:   make(map[string]*clientBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow reports whether the client can make a request now.
+func (l *clientLimiter) allow(client string) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		for c, b := range l.clients {
+			if now.Sub(b.last) > l.idle {
+				delete(l.clients, c)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.clients[client]
+	if !ok {
+		b = &clientBucket{limiter: rate.NewLimiter(l.rate, l.burst)}
+		l.clients[client] = b
+	}
+	b.last = now
+	return b.limiter.AllowN(now, 1)
+}
+
+// subscriberLimits counts the concurrent stream subscribers.
+type subscriberLimits struct {
+	mu       sync.Mutex
+	max      int
+	perAgent int
+	perIP    int
+	total    int
+	agents   map[string]int
+	ips      map[string]int
+}
+
+// acquire reserves a subscriber slot for the given agent and IP.
+// If a limit is reached, it returns the limit and the reason the
+// subscriber is rejected. Otherwise, it returns a func that frees
+// the slot, which can be called more than once.
+func (s *subscriberLimits) acquire(agent, ip string) (release func(), limit, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.max > 0 && s.total >= s.max:
+		return nil, limitSubscribers, "too many subscribers"
+	case s.perAgent > 0 && agent != "" && s.agents[agent] >= s.perAgent:
+		return nil, limitSubscribersAgt, fmt.Sprintf("too many subscribers for agent %s", agent)
+	case s.perIP > 0 && s.ips[ip] >= s.perIP:
+		return nil, limitSubscribersIP, fmt.Sprintf("too many subscribers from %s", ip)
+	}
+
+	s.total++
+	if agent != "" {
+		s.agents[agent]++
+	}
+	s.ips[ip]++
+
+	var once sync.Once
+	return func() { once.Do(func() { s.release(agent, ip) }) }, "", ""
+}
+
+func (s *subscriberLimits) release(agent, ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total--
+	if agent != "" {
+		if s.agents[agent]--; s.agents[agent] <= 0 {
+			delete(s.agents, agent)
+		}
+	}
+	if s.ips[ip]--; s.ips[ip] <= 0 {
+		delete(s.ips, ip)
+	}
+}
+
+// rateLimited returns 429 Too Many Requests to the
+// clients that exceed the configured request rate.
+func (a *API) rateLimited(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.limiter != nil && !a.limiter.allow(a.clientIP(r)) {
+			promLimited.WithLabelValues(limitRate).Inc()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// clientIP returns the IP address of the client that made the
+// request r, read from the configured client IP header if any.
+// The clients can send the header themselves, so only its rightmost
+// entry, appended by the proxy in front of the API, is trusted.
+func (a *API) clientIP(r *http.Request) string {
+	if a.clientIPHeader != "" {
+		values := r.Header.Values(a.clientIPHeader)
+		if len(values) > 0 {
+			last := values[len(values)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return ip
+			}
+		}
+	}
+	return sourceIP(r)
+}
+
+// sourceIP returns the IP address the request r comes from.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rejectUpgrader upgrades the connections of the rejected
+// subscribers, so they receive the reason in a close frame.
+var rejectUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// rejectSubscriber upgrades the connection and closes it
+// right away with the "try again later" code and reason.
+func rejectSubscriber(w http.ResponseWriter, r *http.Request, reason string) error {
+	conn, err := rejectUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason)
+	return conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
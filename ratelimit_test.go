@@ -0,0 +1,111 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRateLimited(t *testing.T) {
+	logger := log.New()
+	api := NewAPI(0, NewSender(logger, SenderConfig{}), mockStorage{}, logger, nil,
+		WithRateLimit(RateLimitConfig{Rate: 0.001, Burst: 2, ClientIPHeader: "X-Forwarded-For"}))
+
+	do := func(ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.Header.Set("X-Forwarded-For", "10.0.0.1, "+ip)
+		rec := httptest.NewRecorder()
+		api.rateLimited(api.statusHandler)(rec, req)
+		return rec.Code
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := do("192.0.2.10"); got != want {
+			t.Errorf("request %d: expected status code %d but got %d", i, want, got)
+		}
+	}
+	if got := do("192.0.2.11"); got != http.StatusOK {
+		t.Errorf("expected other clients not to be limited but got status code %d", got)
+	}
+}
+
+func TestRateLimitedSpoofedHeader(t *testing.T) {
+	logger := log.New()
+	api := NewAPI(0, NewSender(logger, SenderConfig{}), mockStorage{}, logger, nil,
+		WithRateLimit(RateLimitConfig{Rate: 0.001, Burst: 2, ClientIPHeader: "X-Forwarded-For"}))
+
+	// The client sends a different X-Forwarded-For on every
+	// request, and the proxy appends its real address.
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d, 192.0.2.10", i))
+		rec := httptest.NewRecorder()
+		api.rateLimited(api.statusHandler)(rec, req)
+		if rec.Code != want {
+			t.Errorf("request %d: expected status code %d but got %d", i, want, rec.Code)
+		}
+	}
+}
+
+func TestSubscriberLimits(t *testing.T) {
+	logger := log.New()
+	sender := NewSender(logger, SenderConfig{HTTPStream: "stream", PingInterval: 10})
+	api := NewAPI(0, sender, mockStorage{}, logger, nil,
+		WithRateLimit(RateLimitConfig{MaxSubscribers: 2, MaxSubscribersPerAgent: 1}))
+	srv := httptest.NewServer(api.mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/stream?agent_id="
+	dial := func(agent string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url+agent, nil)
+		if err != nil {
+			t.Fatalf("expected no error connecting to the stream but got: %v", err)
+		}
+		return conn
+	}
+	// wantClosed checks that the server closes conn with the given reason.
+	wantClosed := func(conn *websocket.Conn, reason string) {
+		t.Helper()
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err := conn.ReadMessage()
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != websocket.CloseTryAgainLater || ce.Text != reason {
+			t.Errorf("expected close with reason %q but got: %v", reason, err)
+		}
+	}
+
+	a1 := dial("a1")
+	wantClosed(dial("a1"), "too many subscribers for agent a1")
+	a2 := dial("a2")
+	wantClosed(dial("a3"), "too many subscribers")
+
+	// Closing a subscriber frees its slot.
+	a1.Close()
+	defer a2.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		api.subscribers.mu.Lock()
+		total := api.subscribers.total
+		api.subscribers.mu.Unlock()
+		if total < 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the subscriber slot to be freed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	dial("a3").Close()
+}
@@ -0,0 +1,24 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import "time"
+
+// retryBackoff calls f until it succeeds or has been retried maxRetries
+// times, with no limit if maxRetries is negative. It waits backoff
+// before the first retry, doubled on every retry up to maxBackoff,
+// and calls onRetry with the error of every attempt that is retried.
+// It returns the number of attempts and the error of the last one.
+func retryBackoff(backoff, maxBackoff time.Duration, maxRetries int, f func() error, onRetry func(attempt int, err error)) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || (maxRetries >= 0 && attempt > maxRetries) {
+			return attempt, err
+		}
+		onRetry(attempt, err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
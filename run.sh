@@ -2,20 +2,47 @@
 
 # Copyright 2019 Adevinta
 
-export PORT=${PORT:-8080}
-export LOG_LEVEL=${LOG_LEVEL:-Debug}
-export DOGSTATSD_ENABLED=${DOGSTATSD_ENABLED:-false}
-export REDIS_PORT=${REDIS_PORT:-6379}
-export REDIS_USR=${REDIS_USR:-}
-export REDIS_PWD=${REDIS_PWD:-}
-export REDIS_DB=${REDIS_DB:-0}
-export REDIS_TTL=${REDIS_TTL:-0}
+# map_env exports the VULCAN_STREAM_* variable $2 with the value
+# of the legacy variable $1, unless $1 is empty or $2 is already set.
+map_env() {
+  eval "legacy=\${$1:-}; current=\${$2:-}"
+  if [ -n "$legacy" ] && [ -z "$current" ]; then
+    export "$2=$legacy"
+  fi
+}
 
-# Apply env variables
-cat config.toml | envsubst > run.toml
+map_env PORT VULCAN_STREAM_API_PORT
+map_env LOG_LEVEL VULCAN_STREAM_LOGGER_LOGLEVEL
+map_env LOG_FORMAT VULCAN_STREAM_LOGGER_FORMAT
+map_env DOGSTATSD_ENABLED VULCAN_STREAM_METRICS_ENABLED
+map_env PROMETHEUS_ENABLED VULCAN_STREAM_METRICS_PROMETHEUS
+map_env TRACING_ENABLED VULCAN_STREAM_TRACING_ENABLED
+map_env REDIS_HOST VULCAN_STREAM_STORAGE_HOST
+map_env REDIS_PORT VULCAN_STREAM_STORAGE_PORT
+map_env REDIS_USR VULCAN_STREAM_STORAGE_USR
+map_env REDIS_PWD VULCAN_STREAM_STORAGE_PWD
+map_env REDIS_DB VULCAN_STREAM_STORAGE_DB
+map_env REDIS_TTL VULCAN_STREAM_STORAGE_TTL
+map_env REDIS_MODE VULCAN_STREAM_STORAGE_MODE
+map_env REDIS_MASTER_NAME VULCAN_STREAM_STORAGE_MASTERNAME
+map_env REDIS_SENTINEL_USR VULCAN_STREAM_STORAGE_SENTINELUSR
+map_env REDIS_SENTINEL_PWD VULCAN_STREAM_STORAGE_SENTINELPWD
+map_env REDIS_TLS VULCAN_STREAM_STORAGE_TLS
+map_env DEGRADED_MODE VULCAN_STREAM_CACHE_DEGRADED
+map_env CACHE_SNAPSHOT_FILE VULCAN_STREAM_CACHE_SNAPSHOTFILE
+map_env RATE_LIMIT VULCAN_STREAM_RATELIMIT_RATE
+map_env MAX_SUBSCRIBERS VULCAN_STREAM_RATELIMIT_MAXSUBSCRIBERS
+map_env CLIENT_IP_HEADER VULCAN_STREAM_RATELIMIT_CLIENTIPHEADER
+map_env AUDIT_SINK VULCAN_STREAM_AUDIT_SINK
+map_env AUDIT_FILE VULCAN_STREAM_AUDIT_FILE
+map_env AUDIT_IDENTITY_HEADER VULCAN_STREAM_AUDIT_IDENTITYHEADER
+
+# REDIS_ADDRS used to be a list of quoted addresses.
+REDIS_ADDRS=$(echo "${REDIS_ADDRS:-}" | tr -d '" ')
+map_env REDIS_ADDRS VULCAN_STREAM_STORAGE_ADDRS
 
 if [ ! -z "$PG_CA_B64" ]; then
   echo $PG_CA_B64 | base64 -d > /etc/ssl/certs/pg.crt  # for go app
 fi
 
-/app/vulcan-stream run.toml
+exec /app/vulcan-stream config.toml
@@ -0,0 +1,378 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// The keys of the scheduled aborts share the {scheduled} hash
+	// tag, so they are in the same slot in cluster mode and can be
+	// updated in a single transaction.
+	//
+	// scheduledKey is a sorted set of the scheduled abort IDs,
+	// scored by the time they are due, in Unix milliseconds.
+	scheduledKey = "{scheduled}:aborts"
+	// scheduledDataKey is a hash of the scheduled aborts,
+	// JSON encoded, indexed by ID.
+	scheduledDataKey = "{scheduled}:aborts:data"
+
+	defScheduleInterval = 1   // seconds
+	maxDuePerTick       = 100 // scheduled aborts
+
+	// scheduleLease is how long a claimed abort is reserved for the
+	// instance that claimed it. If it is not completed or retried by
+	// then, e.g. because the instance died, it is claimed again.
+	scheduleLease = time.Minute
+	// maxScheduleBackoff is the maximum time
+	// before retrying a failed scheduled abort.
+	maxScheduleBackoff = 5 * time.Minute
+
+	// Actions recorded in the audit log for the scheduled aborts.
+	actionScheduleAbort   = "schedule_abort"
+	actionCancelScheduled = "cancel_scheduled_abort"
+)
+
+// ErrScheduleNotFound is returned when cancelling
+// a scheduled abort that is not pending.
+var ErrScheduleNotFound = errors.New("scheduled abort not found")
+
+// ScheduledAbort is an abort to be performed at a given time.
+type ScheduledAbort struct {
+	ID     string    `json:"id"`
+	At     time.Time `json:"at"`
+	Checks []string  `json:"checks"`
+	ScanID string    `json:"scan_id,omitempty"`
+	Topic  string    `json:"topic"`
+	// Attempts is the number of times performing the abort failed.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// ScheduleDB stores the scheduled aborts until they are due.
+type ScheduleDB interface {
+	AddScheduled(ctx context.Context, s ScheduledAbort) error
+	ListScheduled(ctx context.Context) ([]ScheduledAbort, error)
+	CancelScheduled(ctx context.Context, id string) error
+	// ClaimDue returns at most max aborts due at now and reserves them
+	// until now plus lease, so every abort is claimed by one instance
+	// of the stream at a time even if several of them share the DB.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, max int) ([]ScheduledAbort, error)
+	// CompleteScheduled removes a claimed abort once performed.
+	CompleteScheduled(ctx context.Context, id string) error
+	// RetryScheduled stores a claimed abort that failed, to be
+	// claimed again at the given time, unless it was cancelled.
+	RetryScheduled(ctx context.Context, s ScheduledAbort, at time.Time) error
+}
+
+// WithScheduler enables the aborts scheduled to be performed later,
+// stored in db. The pending aborts are checked every interval, or
+// every second if interval is zero.
+func WithScheduler(db ScheduleDB, interval time.Duration) APIOption {
+	return func(a *API) {
+		if interval <= 0 {
+			interval = defScheduleInterval * time.Second
+		}
+		a.scheduled = db
+		a.scheduleInterval = interval
+	}
+}
+
+// AddScheduled stores s until it is due.
+func (r *RedisDB) AddScheduled(ctx context.Context, s ScheduledAbort) (err error) {
+	defer func(start time.Time) { observeStorageOp("add_scheduled", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.AddScheduled", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	pipe := r.rdb.TxPipeline()
+	pipe.HSet(ctx, scheduledDataKey, s.ID, data)
+	pipe.ZAdd(ctx, scheduledKey, redis.Z{Score: float64(s.At.UnixMilli()), Member: s.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ListScheduled returns the pending scheduled aborts, sooner first.
+func (r *RedisDB) ListScheduled(ctx context.Context) (list []ScheduledAbort, err error) {
+	defer func(start time.Time) { observeStorageOp("list_scheduled", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.ListScheduled", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	all, err := r.rdb.HGetAll(ctx, scheduledDataKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	list = make([]ScheduledAbort, 0, len(all))
+	for _, data := range all {
+		var s ScheduledAbort
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	sortScheduled(list)
+	return list, nil
+}
+
+// CancelScheduled removes the scheduled abort with the given ID.
+// It returns ErrScheduleNotFound if it is not pending.
+func (r *RedisDB) CancelScheduled(ctx context.Context, id string) (err error) {
+	defer func(start time.Time) { observeStorageOp("cancel_scheduled", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.CancelScheduled", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	pipe := r.rdb.TxPipeline()
+	removed := pipe.ZRem(ctx, scheduledKey, id)
+	pipe.HDel(ctx, scheduledDataKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if removed.Val() == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// claimScript moves the due aborts in the sorted set KEYS[1], scored
+// up to ARGV[1], to the end of their lease, ARGV[2], and returns their
+// data in the hash KEYS[2]. At most ARGV[3] aborts are claimed.
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+local claimed = {}
+for _, id in ipairs(ids) do
+	local data = redis.call('HGET', KEYS[2], id)
+	if data then
+		redis.call('ZADD', KEYS[1], ARGV[2], id)
+		table.insert(claimed, data)
+	else
+		redis.call('ZREM', KEYS[1], id)
+	end
+end
+return claimed
+`)
+
+// retryScript stores the data ARGV[2] of the abort ARGV[1] in the hash
+// KEYS[2] and scores it ARGV[3] in the sorted set KEYS[1], only if it
+// is still in the sorted set, that is, if it was not cancelled.
+var retryScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// ClaimDue returns at most max aborts due at now and scores them at
+// the end of the lease, in a single script, so they are not claimed
+// again until then.
+func (r *RedisDB) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, max int) (due []ScheduledAbort, err error) {
+	defer func(start time.Time) { observeStorageOp("claim_scheduled", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.ClaimDue", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	claimed, err := claimScript.Run(ctx, r.rdb,
+		[]string{scheduledKey, scheduledDataKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), max,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range claimed {
+		var s ScheduledAbort
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			return due, err
+		}
+		due = append(due, s)
+	}
+	return due, nil
+}
+
+// CompleteScheduled removes the abort with the given ID.
+func (r *RedisDB) CompleteScheduled(ctx context.Context, id string) (err error) {
+	defer func(start time.Time) { observeStorageOp("complete_scheduled", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.CompleteScheduled", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	pipe := r.rdb.TxPipeline()
+	pipe.ZRem(ctx, scheduledKey, id)
+	pipe.HDel(ctx, scheduledDataKey, id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RetryScheduled stores s to be claimed again at the given
+// time, unless it was cancelled since it was claimed.
+func (r *RedisDB) RetryScheduled(ctx context.Context, s ScheduledAbort, at time.Time) (err error) {
+	defer func(start time.Time) { observeStorageOp("retry_scheduled", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.RetryScheduled", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return retryScript.Run(ctx, r.rdb,
+		[]string{scheduledKey, scheduledDataKey},
+		s.ID, data, at.UnixMilli(),
+	).Err()
+}
+
+func sortScheduled(list []ScheduledAbort) {
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].At.Equal(list[j].At) {
+			return list[i].At.Before(list[j].At)
+		}
+		return list[i].ID < list[j].ID
+	})
+}
+
+// schedule stores req to be performed at req.At on the topic.
+func (a *API) schedule(ctx context.Context, topic string, req *AbortRequest) (*ScheduledAbort, error) {
+	if a.scheduled == nil {
+		return nil, badRequest{errors.New("scheduled aborts are not enabled")}
+	}
+	if len(req.Checks) == 0 {
+		return nil, badRequest{errors.New("checks are required")}
+	}
+	s := &ScheduledAbort{
+		ID:     newUUID(),
+		At:     req.At.UTC(),
+		Checks: req.Checks,
+		ScanID: req.ScanID,
+		Topic:  topic,
+	}
+	if err := a.scheduled.AddScheduled(ctx, *s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// runScheduler performs the scheduled aborts when they are due,
+// until ctx is done. The aborts claimed are performed even if ctx
+// is done meanwhile.
+func (a *API) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(a.scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			a.abortDue(context.WithoutCancel(ctx), now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// abortDue performs the scheduled aborts due at now. The aborts
+// are only removed once performed, so if removing them fails they
+// are performed again when their lease expires. The aborts that
+// fail are retried with exponential backoff.
+func (a *API) abortDue(ctx context.Context, now time.Time) {
+	due, err := a.scheduled.ClaimDue(ctx, now, scheduleLease, maxDuePerTick)
+	if err != nil {
+		a.logger.WithError(err).Error("Error claiming due scheduled aborts")
+	}
+	for _, s := range due {
+		logger := a.logger.WithFields(logrus.Fields{
+			"schedule_id": s.ID,
+			"checks":      s.Checks,
+			"at":          s.At,
+		})
+		err := a.performScheduled(ctx, s)
+		// The invalid aborts would never succeed.
+		if err != nil && !errors.As(err, &badRequest{}) {
+			s.Attempts++
+			retry := now.Add(a.scheduleBackoff(s.Attempts))
+			logger.WithError(err).WithField("retry_at", retry).Error("Error performing scheduled abort")
+			if err := a.scheduled.RetryScheduled(ctx, s, retry); err != nil {
+				logger.WithError(err).Error("Error storing scheduled abort to be retried")
+			}
+			continue
+		}
+		if err != nil {
+			logger.WithError(err).Error("Invalid scheduled abort discarded")
+		} else {
+			logger.Info("Scheduled abort performed")
+		}
+		if err := a.scheduled.CompleteScheduled(ctx, s.ID); err != nil {
+			logger.WithError(err).Error("Error removing performed scheduled abort")
+		}
+	}
+}
+
+// scheduleBackoff returns the time to wait before retrying a
+// scheduled abort that failed the given number of times: the
+// schedule interval, doubled on every attempt up to a maximum.
+func (a *API) scheduleBackoff(attempts int) time.Duration {
+	backoff := a.scheduleInterval
+	for i := 1; i < attempts && backoff < maxScheduleBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxScheduleBackoff)
+}
+
+// performScheduled stores the checks of s as
+// aborted and broadcasts them to the agents.
+func (a *API) performScheduled(ctx context.Context, s ScheduledAbort) error {
+	ctx, span := startSpan(ctx, "API.performScheduled",
+		attribute.String("stream.schedule_id", s.ID),
+		attribute.Int("stream.checks", len(s.Checks)),
+	)
+	var err error
+	defer func() { endSpan(span, err) }()
+
+	topic, err := a.topic(s.Topic)
+	if err != nil {
+		return err
+	}
+	err = a.dispatch(ctx, topic, abortMessages(s.Checks, s.ScanID))
+	return err
+}
+
+// scheduledHandler returns the pending scheduled aborts.
+func (a *API) scheduledHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	list, err := a.scheduled.ListScheduled(r.Context())
+	if err != nil {
+		a.writeErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// cancelScheduledHandler cancels the scheduled abort in the path.
+func (a *API) cancelScheduledHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	err := a.scheduled.CancelScheduled(context.WithoutCancel(r.Context()), r.PathValue("id"))
+	a.recordAudit(r, actionCancelScheduled, nil, "", err)
+	switch {
+	case errors.Is(err, ErrScheduleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		a.writeErr(w, r, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// memSchedule is a ScheduleDB that keeps the scheduled aborts in memory.
+type memSchedule struct {
+	mu      sync.Mutex
+	pending map[string]ScheduledAbort
+	// due is when each pending abort can be claimed.
+	due map[string]time.Time
+}
+
+func (m *memSchedule) AddScheduled(ctx context.Context, s ScheduledAbort) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending == nil {
+		m.pending = make(map[string]ScheduledAbort)
+		m.due = make(map[string]time.Time)
+	}
+	m.pending[s.ID] = s
+	m.due[s.ID] = s.At
+	return nil
+}
+
+func (m *memSchedule) ListScheduled(ctx context.Context) ([]ScheduledAbort, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := []ScheduledAbort{}
+	for _, s := range m.pending {
+		list = append(list, s)
+	}
+	sortScheduled(list)
+	return list, nil
+}
+
+func (m *memSchedule) CancelScheduled(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pending[id]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(m.pending, id)
+	delete(m.due, id)
+	return nil
+}
+
+func (m *memSchedule) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, max int) ([]ScheduledAbort, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []ScheduledAbort
+	for id, at := range m.due {
+		if !at.After(now) && len(due) < max {
+			due = append(due, m.pending[id])
+			m.due[id] = now.Add(lease)
+		}
+	}
+	return due, nil
+}
+
+func (m *memSchedule) CompleteScheduled(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pending, id)
+	delete(m.due, id)
+	return nil
+}
+
+func (m *memSchedule) RetryScheduled(ctx context.Context, s ScheduledAbort, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.due[s.ID]; !ok {
+		return nil
+	}
+	m.pending[s.ID] = s
+	m.due[s.ID] = at
+	return nil
+}
+
+// failStorage fails to store the checks as aborted until it is fixed.
+type failStorage struct {
+	recordStorage
+	failing bool
+}
+
+func (s *failStorage) AddAbortedChecks(ctx context.Context, checks []string) error {
+	if s.failing {
+		return errors.New("redis down")
+	}
+	return s.recordStorage.AddAbortedChecks(ctx, checks)
+}
+
+func TestScheduledAbort(t *testing.T) {
+	logger := log.New()
+	storage := &failStorage{}
+	db := &memSchedule{}
+	sender := NewSender(logger, SenderConfig{HTTPStream: "stream"})
+	api := NewAPI(0, sender, storage, logger, nopMetrics{}, WithScheduler(db, time.Second))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		api.mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var scheduled []ScheduledAbort
+	for _, checks := range []string{`["c1", "c2"]`, `["c3"]`} {
+		rec := do(http.MethodPost, "/abort", fmt.Sprintf(`{"checks": %s, "scan_id": "s1", "at": %q}`, checks, at.Format(time.RFC3339)))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d but got %d: %s", http.StatusAccepted, rec.Code, rec.Body)
+		}
+		var s ScheduledAbort
+		if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+			t.Fatalf("expected no error decoding response but got: %v", err)
+		}
+		if s.ID == "" || !s.At.Equal(at) || s.Topic != "stream" {
+			t.Errorf("unexpected scheduled abort %+v", s)
+		}
+		scheduled = append(scheduled, s)
+	}
+	if len(storage.checks) != 0 {
+		t.Fatalf("expected no checks aborted before they are due but got %v", storage.checks)
+	}
+
+	rec := do(http.MethodGet, "/aborts/scheduled", "")
+	var list []ScheduledAbort
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 2 {
+		t.Fatalf("expected 2 scheduled aborts but got %s, error: %v", rec.Body, err)
+	}
+
+	if rec := do(http.MethodDelete, "/aborts/scheduled/"+scheduled[1].ID, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d cancelling but got %d", http.StatusNoContent, rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/aborts/scheduled/"+scheduled[1].ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d cancelling twice but got %d", http.StatusNotFound, rec.Code)
+	}
+
+	// The failed aborts are retried after a backoff.
+	storage.failing = true
+	api.abortDue(context.Background(), at)
+	if list, _ := db.ListScheduled(context.Background()); len(list) != 1 || list[0].Attempts != 1 || !list[0].At.Equal(at) {
+		t.Fatalf("expected failed abort to be pending but got %v", list)
+	}
+
+	storage.failing = false
+	api.abortDue(context.Background(), at.Add(-time.Second))
+	if len(storage.checks) != 0 {
+		t.Fatalf("expected no checks aborted before they are due but got %v", storage.checks)
+	}
+	api.abortDue(context.Background(), at)
+	if len(storage.checks) != 0 {
+		t.Fatalf("expected no checks aborted before the backoff but got %v", storage.checks)
+	}
+	api.abortDue(context.Background(), at.Add(time.Second))
+	if got := strings.Join(storage.checks, ","); got != "c1,c2" {
+		t.Errorf("expected checks c1,c2 aborted but got %v", got)
+	}
+	if list, _ := db.ListScheduled(context.Background()); len(list) != 0 {
+		t.Errorf("expected no pending aborts but got %v", list)
+	}
+}
+
+func TestScheduledAbortLease(t *testing.T) {
+	logger := log.New()
+	db := &memSchedule{}
+	api := NewAPI(0, NewSender(logger, SenderConfig{HTTPStream: "stream"}), &recordStorage{}, logger, nopMetrics{},
+		WithScheduler(db, time.Second))
+
+	at := time.Now().UTC()
+	db.AddScheduled(context.Background(), ScheduledAbort{ID: "s1", At: at, Checks: []string{"c1"}, Topic: "stream"})
+
+	// A claimed abort is kept until it is performed, but it is
+	// not claimed again until its lease expires.
+	due, _ := db.ClaimDue(context.Background(), at, scheduleLease, maxDuePerTick)
+	if len(due) != 1 {
+		t.Fatalf("expected the abort to be claimed but got %v", due)
+	}
+	if due, _ := db.ClaimDue(context.Background(), at.Add(time.Second), scheduleLease, maxDuePerTick); len(due) != 0 {
+		t.Fatalf("expected claimed abort not to be claimed again but got %v", due)
+	}
+	if list, _ := db.ListScheduled(context.Background()); len(list) != 1 {
+		t.Fatalf("expected claimed abort to be pending but got %v", list)
+	}
+
+	api.abortDue(context.Background(), at.Add(scheduleLease))
+	if list, _ := db.ListScheduled(context.Background()); len(list) != 0 {
+		t.Errorf("expected abort to be removed once performed but got %v", list)
+	}
+}
+
+func TestRunSchedulerStops(t *testing.T) {
+	logger := log.New()
+	db := &memSchedule{}
+	storage := &recordStorage{}
+	api := NewAPI(0, NewSender(logger, SenderConfig{HTTPStream: "stream"}), storage, logger, nopMetrics{},
+		WithScheduler(db, time.Millisecond))
+	db.AddScheduled(context.Background(), ScheduledAbort{ID: "s1", At: time.Now(), Checks: []string{"c1"}, Topic: "stream"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		api.runScheduler(ctx)
+		close(stopped)
+	}()
+	for {
+		if list, _ := db.ListScheduled(context.Background()); len(list) == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the scheduler to stop once its context is done")
+	}
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if got := strings.Join(storage.checks, ","); got != "c1" {
+		t.Errorf("expected check c1 aborted but got %v", got)
+	}
+}
+
+func TestRedisScheduleDB(t *testing.T) {
+	mr := miniredis.RunT(t)
+	port, _ := strconv.Atoi(mr.Port())
+	db, err := NewRedisDB(RedisConfig{Host: mr.Host(), Port: port})
+	if err != nil {
+		t.Fatalf("expected no error connecting to redis but got: %v", err)
+	}
+	ctx := context.Background()
+
+	at := time.Now().UTC().Truncate(time.Millisecond)
+	for _, s := range []ScheduledAbort{
+		{ID: "s1", At: at, Checks: []string{"c1"}, Topic: "stream"},
+		{ID: "s2", At: at.Add(time.Second), Checks: []string{"c2"}, Topic: "stream"},
+	} {
+		if err := db.AddScheduled(ctx, s); err != nil {
+			t.Fatalf("expected no error scheduling abort but got: %v", err)
+		}
+	}
+
+	due, err := db.ClaimDue(ctx, at, scheduleLease, maxDuePerTick)
+	if err != nil || len(due) != 1 || due[0].ID != "s1" {
+		t.Fatalf("expected s1 to be claimed but got %v, error: %v", due, err)
+	}
+	due, err = db.ClaimDue(ctx, at.Add(time.Second), scheduleLease, maxDuePerTick)
+	if err != nil || len(due) != 1 || due[0].ID != "s2" {
+		t.Fatalf("expected only s2 to be claimed while s1 is leased but got %v, error: %v", due, err)
+	}
+	if list, _ := db.ListScheduled(ctx); len(list) != 2 {
+		t.Fatalf("expected claimed aborts to be pending but got %v", list)
+	}
+
+	// s1 fails and is retried, s2 is cancelled while being performed.
+	s1 := ScheduledAbort{ID: "s1", At: at, Checks: []string{"c1"}, Topic: "stream", Attempts: 1}
+	if err := db.RetryScheduled(ctx, s1, at.Add(2*time.Second)); err != nil {
+		t.Fatalf("expected no error retrying abort but got: %v", err)
+	}
+	if err := db.CancelScheduled(ctx, "s2"); err != nil {
+		t.Fatalf("expected no error cancelling abort but got: %v", err)
+	}
+	if err := db.RetryScheduled(ctx, due[0], at.Add(2*time.Second)); err != nil {
+		t.Fatalf("expected no error retrying abort but got: %v", err)
+	}
+
+	due, err = db.ClaimDue(ctx, at.Add(2*time.Second), scheduleLease, maxDuePerTick)
+	if err != nil || len(due) != 1 || due[0].ID != "s1" || due[0].Attempts != 1 {
+		t.Fatalf("expected s1 to be claimed again but got %v, error: %v", due, err)
+	}
+	if err := db.CompleteScheduled(ctx, "s1"); err != nil {
+		t.Fatalf("expected no error completing abort but got: %v", err)
+	}
+	if list, _ := db.ListScheduled(ctx); len(list) != 0 {
+		t.Errorf("expected no pending aborts but got %v", list)
+	}
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	api := &API{scheduleInterval: time.Second}
+	testCases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 100, want: maxScheduleBackoff},
+	}
+	for _, tc := range testCases {
+		if got := api.scheduleBackoff(tc.attempts); got != tc.want {
+			t.Errorf("attempts %d: expected backoff %v but got %v", tc.attempts, tc.want, got)
+		}
+	}
+}
+
+func TestScheduledAbortDisabled(t *testing.T) {
+	logger := log.New()
+	api := NewAPI(0, NewSender(logger, SenderConfig{HTTPStream: "stream"}), &recordStorage{}, logger, nopMetrics{})
+
+	at := time.Now().Add(time.Hour).Format(time.RFC3339)
+	rec := httptest.NewRecorder()
+	api.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/abort", strings.NewReader(`{"checks": ["c1"], "at": "`+at+`"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d but got %d", http.StatusBadRequest, rec.Code)
+	}
+}
@@ -5,61 +5,434 @@ Copyright 2019 Adevinta
 package stream
 
 import (
+	"compress/flate"
+	"context"
+	"io"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/danfaizer/gowse"
+	"github.com/adevinta/vulcan-stream/hub"
+	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// OverflowDropOldest drops the oldest queued message of a
+	// subscriber to make room for a new one when its queue is full.
+	OverflowDropOldest = string(hub.DropOldest)
+	// OverflowDisconnect disconnects the subscribers whose queue is full.
+	OverflowDisconnect = string(hub.Disconnect)
 )
 
 // SenderConfig defines required Vulcan websocket event server configuration
 type SenderConfig struct {
-	HTTPStream   string
+	// HTTPStream is the default topic, served at /stream.
+	HTTPStream string
+	// Topics are the additional topics, each served at /stream/{topic}.
+	Topics       []string
 	PingInterval time.Duration
+	// SigningKeyFile is the PEM encoded Ed25519 private key the
+	// messages are signed with. If empty, messages are not signed.
+	SigningKeyFile string
+	// PublicKeyFiles are PEM encoded Ed25519 public keys served by
+	// the /keys endpoint along with the one of the signing key, e.g.
+	// the previous and next signing keys while rotating them.
+	PublicKeyFiles []string
+	// QueueSize is the number of messages queued for each
+	// subscriber before applying the OverflowPolicy.
+	QueueSize int
+	// OverflowPolicy is what to do when the queue of a subscriber is
+	// full, either drop_oldest, the default, or disconnect.
+	OverflowPolicy string
+	// WriteTimeout is the number of seconds a write
+	// to a subscriber can take before it is disconnected.
+	WriteTimeout int
+	// Compression enables the permessage-deflate extension
+	// for the subscribers that request it.
+	Compression bool
+	// CompressionLevel is the deflate compression level, from 1,
+	// the fastest and the default, to 9, the best compression.
+	CompressionLevel int
+	// CompressionThreshold is the size in bytes from which the
+	// messages are compressed. Smaller ones are sent uncompressed.
+	CompressionThreshold int
 }
 
 // Sender defines a websocket event server
 type Sender struct {
-	topic  *gowse.Topic
-	logger logrus.FieldLogger
-	config SenderConfig
+	hub      *hub.Hub
+	logger   logrus.FieldLogger
+	config   SenderConfig
+	upgrader websocket.Upgrader
+	running  atomic.Bool
+	// pingReset receives the new ping interval
+	// when it is changed at runtime.
+	pingReset chan time.Duration
+	// topics are the names of the topics served.
+	topics map[string]bool
+	// keyring signs the messages if not nil.
+	keyring atomic.Pointer[Keyring]
+	// deflaters holds the flate writers used
+	// to measure the compressed messages.
+	deflaters sync.Pool
+	// onEvent, if set, is called when the
+	// agents connect and disconnect.
+	onEvent func(Event)
+	// bridge, if set, mirrors the
+	// messages to an event bus.
+	bridge *Bridge
+}
+
+// subscriber is the value the subscriber
+// connections are registered in the hub with.
+type subscriber struct {
+	logger      logrus.FieldLogger
+	agentID     string
+	remoteAddr  string
+	topics      []string
+	connectedAt time.Time
+	// compress is true if the connection
+	// negotiated permessage-deflate.
+	compress bool
 }
 
 // NewSender creates a Vulcan Stream sender instance
 func NewSender(l logrus.FieldLogger, c SenderConfig) *Sender {
-	server := gowse.NewServer(l.WithFields(logrus.Fields{}))
-	topic := server.CreateTopic(c.HTTPStream)
-	return &Sender{topic: topic, logger: l, config: c}
+	s := &Sender{
+		logger: l,
+		config: c,
+		upgrader: websocket.Upgrader{
+			CheckOrigin:       func(r *http.Request) bool { return true },
+			EnableCompression: c.Compression,
+		},
+		pingReset: make(chan time.Duration, 1),
+		topics:    map[string]bool{c.HTTPStream: true},
+	}
+	for _, t := range c.Topics {
+		s.topics[t] = true
+	}
+	if s.config.CompressionLevel == 0 {
+		s.config.CompressionLevel = flate.BestSpeed
+	}
+	s.deflaters.New = func() interface{} {
+		w, _ := flate.NewWriter(io.Discard, s.config.CompressionLevel)
+		return w
+	}
+	s.hub = hub.New(hub.Config{
+		QueueSize:    c.QueueSize,
+		Overflow:     hub.Policy(c.OverflowPolicy),
+		WriteTimeout: time.Duration(c.WriteTimeout) * time.Second,
+		OnSend:       s.onSend,
+		OnWrite:      s.onWrite,
+		OnClose:      s.onClose,
+	})
+	return s
+}
+
+// SetKeyring sets the keys the messages are signed with. A nil keyring
+// disables signing. It can be called while the sender is running to
+// rotate the keys.
+func (s *Sender) SetKeyring(k *Keyring) {
+	s.keyring.Store(k)
+}
+
+// Keyring returns the keys the messages are signed
+// with, or nil if the messages are not signed.
+func (s *Sender) Keyring() *Keyring {
+	return s.keyring.Load()
+}
+
+// SetEventHandler sets the function called with the events of the
+// agents connecting to and leaving the stream. It must be called
+// before the sender handles any connection.
+func (s *Sender) SetEventHandler(h func(Event)) {
+	s.onEvent = h
+}
+
+// SetBridge sets the bridge every message published is mirrored
+// through. It must be called before the sender publishes any message.
+func (s *Sender) SetBridge(b *Bridge) {
+	s.bridge = b
+}
+
+// event calls the event handler, if any, with e.
+func (s *Sender) event(e Event) {
+	if s.onEvent != nil {
+		s.onEvent(e)
+	}
 }
 
 // Start initializes a websocket event server instance with provided configuration
 func (s *Sender) Start() {
 	go s.ping()
+	s.running.Store(true)
 	s.logger.Info("Vulcan Stream Sender started")
 }
 
-// HandleConn handles a connection to sender web socket topic.
-func (s *Sender) HandleConn(w http.ResponseWriter, r *http.Request) {
-	if err := s.topic.SubscriberHandler(w, r); err != nil {
-		s.logger.Error("error handling subscriber request: %+v", err)
+// Running reports whether the sender has been started.
+func (s *Sender) Running() bool {
+	return s.running.Load()
+}
+
+// HasTopic reports whether the sender serves the given topic.
+func (s *Sender) HasTopic(topic string) bool {
+	return s.topics[topic]
+}
+
+// HandleConn handles a connection to sender web socket topic. The
+// connection is subscribed to the given topics, which must be served
+// by the sender, or to the default one if none is given.
+func (s *Sender) HandleConn(w http.ResponseWriter, r *http.Request, topics ...string) {
+	if len(topics) == 0 {
+		topics = []string{s.config.HTTPStream}
+	}
+	logger := loggerFrom(r.Context(), s.logger).WithFields(logrus.Fields{
+		"agent_id":    AgentID(r),
+		"remote_addr": r.RemoteAddr,
+		"topics":      topics,
+	})
+	// The subprotocol is negotiated here, instead of by the upgrader,
+	// to honour the preference order of the agent.
+	var header http.Header
+	if p := selectSubprotocol(r); p != "" {
+		header = http.Header{"Sec-Websocket-Protocol": {p}}
+	}
+	conn, err := s.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		logger.WithError(err).Error("Error handling subscriber request")
+		return
+	}
+	if p := conn.Subprotocol(); p != "" {
+		logger = logger.WithField("subprotocol", p)
+	}
+	sub := &subscriber{
+		logger:      logger,
+		agentID:     AgentID(r),
+		remoteAddr:  r.RemoteAddr,
+		topics:      topics,
+		connectedAt: time.Now().UTC(),
+		compress:    s.config.Compression && offersDeflate(r),
+	}
+	if sub.compress {
+		if err := conn.SetCompressionLevel(s.config.CompressionLevel); err != nil {
+			logger.WithError(err).Error("Error setting compression level")
+		}
 	}
+
+	promSubscribers.Inc()
+	s.hub.Register(conn, sub, topics...)
+	logger.Info("Agent connected to the stream")
+	s.event(Event{Type: EventAgentConnected, AgentID: sub.agentID, Topics: topics})
 }
 
-// Broadcast emits msg to the specified Stream channel
-func (s *Sender) Broadcast(msg Message) {
-	s.topic.Broadcast(msg)
-	s.logger.WithFields(logrus.Fields{
+// AgentID returns the ID the agent connecting to
+// the stream identifies with, if any. It is read from
+// the X-Agent-ID header or the agent_id query parameter.
+func AgentID(r *http.Request) string {
+	if id := r.Header.Get("X-Agent-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("agent_id")
+}
+
+// onSend records the outcome of sending a message to a subscriber.
+func (s *Sender) onSend(c *hub.Conn, o hub.Outcome) {
+	promSendOutcomes.WithLabelValues(string(o)).Inc()
+	switch o {
+	case hub.DroppedOldest:
+		connLogger(c).Warn("Slow subscriber, oldest queued message dropped")
+	case hub.Disconnected:
+		connLogger(c).Warn("Disconnecting slow subscriber")
+	}
+}
+
+// onClose records that a subscriber is gone.
+func (s *Sender) onClose(c *hub.Conn, err error) {
+	promSubscribers.Dec()
+	logger := connLogger(c)
+	if err != nil && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		logger = logger.WithError(err)
+	}
+	logger.Info("Agent disconnected from the stream")
+	sub := c.Value().(*subscriber)
+	s.event(Event{Type: EventAgentDisconnected, AgentID: sub.agentID, Topics: sub.topics})
+}
+
+// connLogger returns the logger of the subscriber connection c.
+func connLogger(c *hub.Conn) logrus.FieldLogger {
+	return c.Value().(*subscriber).logger
+}
+
+// Broadcast emits msg to the default topic of the stream.
+// The trace context in ctx is propagated to the agents
+// through the message traceparent field.
+func (s *Sender) Broadcast(ctx context.Context, msg Message) {
+	s.Publish(ctx, s.config.HTTPStream, msg)
+}
+
+// Publish emits msg to the given topic of the stream, which must
+// be served by the sender. The trace context in ctx is propagated
+// to the agents through the message traceparent field.
+func (s *Sender) Publish(ctx context.Context, topic string, msg Message) {
+	ctx, span := startSpan(ctx, "Sender.Publish",
+		attribute.String("stream.topic", topic),
+		attribute.String("stream.action", msg.Action),
+		attribute.String("stream.check_id", msg.CheckID),
+	)
+	defer span.End()
+	msg = stamp(msg)
+	msg.TraceParent = traceParent(ctx)
+
+	start := time.Now()
+	s.publish(topic, msg)
+	promBroadcastDuration.WithLabelValues(msg.Action).Observe(time.Since(start).Seconds())
+	logger := loggerFrom(ctx, s.logger).WithField("topic", topic)
+	if msg.AgentID != "" {
+		logger = logger.WithField("agent_id", msg.AgentID)
+	}
+	logger.WithFields(logrus.Fields{
 		"msg": msg,
 	}).Info("Message pushed to the stream successfully")
 }
 
+// publish queues msg for every subscriber of the topic, and then
+// mirrors it through the bridge. The message is signed once, and encoded, and
+// compressed if needed, once for each subprotocol used by the subscribers.
+func (s *Sender) publish(topic string, msg Message) {
+	if k := s.keyring.Load(); k != nil {
+		signed, err := k.sign(msg)
+		if err != nil {
+			s.logger.WithError(err).Error("Error signing message")
+			return
+		}
+		msg = signed
+	}
+
+	type encoding struct {
+		subprotocol string
+		compress    bool
+	}
+	type encoded struct {
+		frame hub.Frame
+		err   error
+	}
+	encodings := make(map[encoding]encoded)
+	s.hub.PublishFunc(topic, func(c *hub.Conn) (hub.Frame, error) {
+		key := encoding{subprotocol: c.Subprotocol(), compress: c.Value().(*subscriber).compress}
+		e, ok := encodings[key]
+		if !ok {
+			e.frame, e.err = s.encode(key.subprotocol, key.compress, msg)
+			if e.err != nil {
+				s.logger.WithError(e.err).WithField("subprotocol", key.subprotocol).Error("Error encoding message")
+			}
+			encodings[key] = e
+		}
+		return e.frame, e.err
+	})
+	s.bridge.Mirror(topic, msg)
+}
+
+// encode returns the frame msg is sent with to the subscribers using
+// the given subprotocol. If compress is true and the message reaches
+// the compression threshold, the frame is prepared to be compressed.
+func (s *Sender) encode(subprotocol string, compress bool, msg Message) (hub.Frame, error) {
+	typ, data, err := EncodeMessage(subprotocol, msg)
+	if err != nil {
+		return hub.Frame{}, err
+	}
+	f := hub.Frame{Type: typ, Data: data}
+	if !compress || len(data) < s.config.CompressionThreshold {
+		return f, nil
+	}
+	// The prepared message is compressed once
+	// and shared by all the subscribers.
+	f.Prepared, err = websocket.NewPreparedMessage(typ, data)
+	if err != nil {
+		return hub.Frame{}, err
+	}
+	f.Compressed, err = s.deflatedSize(data)
+	return f, err
+}
+
+// deflatedSize returns the size of data once compressed
+// as a permessage-deflate message.
+func (s *Sender) deflatedSize(data []byte) (int, error) {
+	var n countWriter
+	w := s.deflaters.Get().(*flate.Writer)
+	defer s.deflaters.Put(w)
+	w.Reset(&n)
+	if _, err := w.Write(data); err != nil {
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	// The messages are sent without the 4 bytes
+	// tail of the flushed deflate block.
+	return int(n) - 4, nil
+}
+
+// countWriter counts the bytes written to it.
+type countWriter int64
+
+func (n *countWriter) Write(p []byte) (int, error) {
+	*n += countWriter(len(p))
+	return len(p), nil
+}
+
+// onWrite records the bytes saved by compressing the messages.
+func (s *Sender) onWrite(c *hub.Conn, f hub.Frame) {
+	if f.Prepared == nil {
+		return
+	}
+	promCompressedMessages.Inc()
+	if saved := len(f.Data) - f.Compressed; saved > 0 {
+		promCompressionSaved.Add(float64(saved))
+	}
+}
+
+// offersDeflate reports whether the agent in r requests
+// the permessage-deflate extension.
+func offersDeflate(r *http.Request) bool {
+	for _, h := range r.Header.Values("Sec-Websocket-Extensions") {
+		for _, ext := range strings.Split(h, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ping starts a scheduler which will broadcast pings at configured interval
 func (s *Sender) ping() {
-	pingMsg := Message{Action: "ping"}
-
 	ticker := time.NewTicker(s.config.PingInterval * time.Second)
 	defer ticker.Stop()
-	for range ticker.C {
-		s.topic.Broadcast(pingMsg)
+	for {
+		select {
+		case <-ticker.C:
+			for t := range s.topics {
+				s.publish(t, stamp(Message{Action: actionPing}))
+			}
+		case d := <-s.pingReset:
+			ticker.Reset(d)
+		}
+	}
+}
+
+// SetPingInterval changes the interval between pings.
+// The interval must be positive.
+func (s *Sender) SetPingInterval(d time.Duration) {
+	// Only the latest interval matters, so drop
+	// any previous one that was not applied yet.
+	select {
+	case <-s.pingReset:
+	default:
 	}
+	s.pingReset <- d
 }
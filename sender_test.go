@@ -0,0 +1,167 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSenderBroadcast(t *testing.T) {
+	s := NewSender(log.New(), SenderConfig{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.HandleConn(w, r)
+	}))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	var clients []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("expected no error connecting but got: %v", err)
+		}
+		defer conn.Close()
+		clients = append(clients, conn)
+	}
+	waitSubscribers(t, s, 3)
+
+	s.Broadcast(context.Background(), Message{CheckID: "c1", Action: actionAbort})
+	for i, conn := range clients {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var m Message
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("client %d: expected no error reading message but got: %v", i, err)
+		}
+		if m.CheckID != "c1" || m.Action != actionAbort {
+			t.Errorf("client %d: unexpected message %+v", i, m)
+		}
+	}
+
+	clients[0].Close()
+	waitSubscribers(t, s, 2)
+}
+
+func TestSenderTopics(t *testing.T) {
+	logger := log.New()
+	s := NewSender(logger, SenderConfig{HTTPStream: "stream", Topics: []string{"agent-control"}})
+	api := NewAPI(0, s, mockStorage{}, logger, nil)
+	srv := httptest.NewServer(api.mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	dial := func(path string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url+path, nil)
+		if err != nil {
+			t.Fatalf("expected no error connecting to %s but got: %v", path, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	legacy := dial("/stream")
+	def := dial("/stream/stream")
+	control := dial("/stream/agent-control")
+	waitSubscribers(t, s, 3)
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url+"/stream/unknown", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected unknown topic to be not found but got: %v", err)
+	}
+
+	s.Publish(context.Background(), "agent-control", Message{AgentID: "a1", Action: "disconnect"})
+	s.Broadcast(context.Background(), Message{CheckID: "c1", Action: actionAbort})
+
+	for name, conn := range map[string]*websocket.Conn{"legacy": legacy, "default": def, "control": control} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var m Message
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("%s: expected no error reading message but got: %v", name, err)
+		}
+		want := actionAbort
+		if name == "control" {
+			want = "disconnect"
+		}
+		if m.Action != want {
+			t.Errorf("%s: expected action %q but got %q", name, want, m.Action)
+		}
+	}
+}
+
+func TestSenderCompression(t *testing.T) {
+	s := NewSender(log.New(), SenderConfig{Compression: true, CompressionThreshold: 256})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.HandleConn(w, r)
+	}))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	var clients []*websocket.Conn
+	for _, compress := range []bool{true, false} {
+		dialer := websocket.Dialer{EnableCompression: compress}
+		conn, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("expected no error connecting but got: %v", err)
+		}
+		defer conn.Close()
+		clients = append(clients, conn)
+	}
+	waitSubscribers(t, s, 2)
+
+	compressed := testutil.ToFloat64(promCompressedMessages)
+	saved := testutil.ToFloat64(promCompressionSaved)
+
+	large := json.RawMessage(`{"checks":["` + strings.Repeat("c", 1024) + `"]}`)
+	s.Broadcast(context.Background(), Message{CheckID: "c1", Action: actionAbort})
+	s.Broadcast(context.Background(), Message{CheckID: "c2", Action: actionAbort, Payload: large})
+	for i, conn := range clients {
+		for _, want := range []string{"c1", "c2"} {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var m Message
+			if err := conn.ReadJSON(&m); err != nil {
+				t.Fatalf("client %d: expected no error reading message but got: %v", i, err)
+			}
+			if m.CheckID != want {
+				t.Errorf("client %d: expected message for %s but got %+v", i, want, m)
+			}
+		}
+	}
+
+	// Only the large message sent to the client
+	// that requested compression is compressed.
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(promCompressedMessages)-compressed != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 1 compressed message but got %v", testutil.ToFloat64(promCompressedMessages)-compressed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(promCompressionSaved) - saved; got < 900 {
+		t.Errorf("expected at least 900 bytes saved but got %v", got)
+	}
+}
+
+// waitSubscribers waits for the sender to have n subscribers.
+func waitSubscribers(t *testing.T, s *Sender, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := s.hub.Count()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers but got %d", n, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
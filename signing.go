@@ -0,0 +1,320 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+const (
+	jwkKeyType = "OKP"
+	jwkCurve   = "Ed25519"
+)
+
+var (
+	// ErrUnsigned is returned by Verify for the messages without signature.
+	ErrUnsigned = errors.New("message is not signed")
+	// ErrUnknownKey is returned by Verify for the messages signed with
+	// a key that is not in the given key set.
+	ErrUnknownKey = errors.New("message signed with an unknown key")
+	// ErrBadSignature is returned by Verify for the messages
+	// whose signature does not match their content.
+	ErrBadSignature = errors.New("invalid message signature")
+)
+
+// Keyring holds the key the messages are signed with and the
+// public keys the agents can verify the messages with.
+type Keyring struct {
+	keyID string
+	key   ed25519.PrivateKey
+	// public holds the public key of key and the ones of the
+	// previous and next signing keys, so agents can verify the
+	// messages while the signing key is rotated.
+	public []JWK
+}
+
+// JWK is an Ed25519 public key in JSON Web Key format (RFC 8037).
+type JWK struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	KeyID   string `json:"kid"`
+	X       string `json:"x"`
+}
+
+// JWKS is a JSON Web Key Set, as returned by the /keys endpoint.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeyring loads the keys configured in c. It returns
+// nil if signing is disabled, that is, if no signing key
+// file is configured.
+func LoadKeyring(c SenderConfig) (*Keyring, error) {
+	if c.SigningKeyFile == "" {
+		return nil, nil
+	}
+	key, err := readPrivateKey(c.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	// The IDs are always derived from the keys, so a key has the
+	// same ID when it is signing and when it is only published.
+	pub := key.Public().(ed25519.PublicKey)
+	keyID := KeyID(pub)
+
+	k := &Keyring{keyID: keyID, key: key, public: []JWK{newJWK(keyID, pub)}}
+	for _, path := range c.PublicKeyFiles {
+		pub, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		k.public = append(k.public, newJWK(KeyID(pub), pub))
+	}
+	return k, nil
+}
+
+// KeyID returns the ID of a public key, derived from its hash.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+func newJWK(keyID string, pub ed25519.PublicKey) JWK {
+	return JWK{
+		KeyType: jwkKeyType,
+		Curve:   jwkCurve,
+		KeyID:   keyID,
+		X:       base64.RawURLEncoding.EncodeToString(pub),
+	}
+}
+
+// readPrivateKey reads a PEM encoded PKCS #8 Ed25519 private key.
+func readPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid private key in %s: not an Ed25519 key", path)
+	}
+	return ed, nil
+}
+
+// readPublicKey reads a PEM encoded PKIX Ed25519 public key.
+func readPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key in %s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid public key in %s: not an Ed25519 key", path)
+	}
+	return ed, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+// GenerateKey generates an Ed25519 signing key and returns the
+// PEM encoded private key and the PEM encoded public key.
+func GenerateKey() (private, public []byte, err error) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	private = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	der, err = x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	public = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return private, public, nil
+}
+
+// JWKS returns the public keys of the keyring.
+func (k *Keyring) JWKS() JWKS {
+	if k == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return JWKS{Keys: k.public}
+}
+
+// Sign returns the JSON encoding of msg signed with the keyring
+// signing key. The "kid" field of the result is the ID of the key
+// and the "sig" field is the base64url encoded Ed25519 signature
+// of the RFC 8785 canonical form of the rest of the message.
+func (k *Keyring) Sign(msg Message) ([]byte, error) {
+	msg, err := k.sign(msg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(msg)
+}
+
+// sign returns msg with the KeyID and Sig fields set, so it
+// can be signed once and then encoded for every subprotocol.
+func (k *Keyring) sign(msg Message) (Message, error) {
+	msg.KeyID = k.keyID
+	msg.Sig = ""
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return Message{}, err
+	}
+	canonical, err := canonicalize(data)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.Sig = base64.RawURLEncoding.EncodeToString(ed25519.Sign(k.key, canonical))
+	return msg, nil
+}
+
+// canonicalize returns the form of the JSON object in data the
+// signature is computed over: the object without the "sig" field,
+// canonicalized as defined by RFC 8785.
+func canonicalize(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "sig")
+	return canonicalJSON(fields)
+}
+
+// Verify checks the signature of the message in data, as received
+// from the stream, with the public keys in keys, indexed by key ID.
+// It returns the decoded message if the signature is valid.
+func Verify(data []byte, keys map[string]ed25519.PublicKey) (Message, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return Message{}, err
+	}
+	canonical, err := canonicalize(data)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := verify(msg, canonical, keys); err != nil {
+		return Message{}, err
+	}
+	return msg, nil
+}
+
+// VerifyMessage checks the signature of msg, as decoded with
+// DecodeMessage, with the public keys in keys, indexed by key ID.
+// It is meant for the messages received with a binary subprotocol;
+// the ones received as JSON should be checked with Verify, which
+// also covers the fields unknown to this version of Message.
+func VerifyMessage(msg Message, keys map[string]ed25519.PublicKey) error {
+	unsigned := msg
+	unsigned.Sig = ""
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return err
+	}
+	canonical, err := canonicalize(data)
+	if err != nil {
+		return err
+	}
+	return verify(msg, canonical, keys)
+}
+
+// verify checks that the signature of msg is valid for canonical.
+func verify(msg Message, canonical []byte, keys map[string]ed25519.PublicKey) error {
+	if msg.Sig == "" {
+		return ErrUnsigned
+	}
+	pub, ok := keys[msg.KeyID]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, msg.KeyID)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(msg.Sig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if !ed25519.Verify(pub, canonical, sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// PublicKeys returns the Ed25519 keys in the key set, indexed by key ID.
+func (s JWKS) PublicKeys() (map[string]ed25519.PublicKey, error) {
+	keys := make(map[string]ed25519.PublicKey, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.KeyType != jwkKeyType || k.Curve != jwkCurve {
+			continue
+		}
+		pub, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key %q", k.KeyID)
+		}
+		keys[k.KeyID] = ed25519.PublicKey(pub)
+	}
+	return keys, nil
+}
+
+// FetchKeys returns the public keys served by the /keys endpoint
+// at url, indexed by key ID, to be used with Verify.
+func FetchKeys(ctx context.Context, url string) (map[string]ed25519.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching keys: %s", resp.Status)
+	}
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	return set.PublicKeys()
+}
+
+// keysHandler returns the public keys the messages can be verified with.
+func (a *API) keysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	json.NewEncoder(w).Encode(a.sender.Keyring().JWKS())
+}
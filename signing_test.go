@@ -0,0 +1,169 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// writeKey generates a signing key in dir and returns
+// the paths of the private and public key files.
+func writeKey(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	private, public, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("expected no error generating key but got: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, private, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".pub", public, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, path + ".pub"
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, keyPub := writeKey(t, dir, "current")
+	nextFile, nextPub := writeKey(t, dir, "next")
+	pub, err := readPublicKey(keyPub)
+	if err != nil {
+		t.Fatalf("expected no error reading public key but got: %v", err)
+	}
+	kid := KeyID(pub)
+
+	k, err := LoadKeyring(SenderConfig{SigningKeyFile: keyFile, PublicKeyFiles: []string{nextPub}})
+	if err != nil {
+		t.Fatalf("expected no error loading keyring but got: %v", err)
+	}
+	keys, err := k.JWKS().PublicKeys()
+	if err != nil {
+		t.Fatalf("expected no error reading public keys but got: %v", err)
+	}
+	if len(keys) != 2 || keys[kid] == nil {
+		t.Fatalf("expected the signing key %s and the next key but got %v", kid, keys)
+	}
+
+	// Once rotated, the keys keep the IDs they were published with.
+	rotated, err := LoadKeyring(SenderConfig{SigningKeyFile: nextFile, PublicKeyFiles: []string{keyPub}})
+	if err != nil {
+		t.Fatalf("expected no error loading rotated keyring but got: %v", err)
+	}
+	rotatedKeys, err := rotated.JWKS().PublicKeys()
+	if err != nil {
+		t.Fatalf("expected no error reading public keys but got: %v", err)
+	}
+	for id := range keys {
+		if rotatedKeys[id] == nil {
+			t.Errorf("expected key %s to be published after the rotation, got %v", id, rotatedKeys)
+		}
+	}
+
+	msg := stamp(Message{CheckID: "c1", Action: actionAbort, Payload: json.RawMessage(`{"b": 1, "a": "<x>"}`)})
+	data, err := k.Sign(msg)
+	if err != nil {
+		t.Fatalf("expected no error signing message but got: %v", err)
+	}
+
+	got, err := Verify(data, keys)
+	if err != nil {
+		t.Fatalf("expected valid signature but got: %v", err)
+	}
+	if got.CheckID != "c1" || got.KeyID != kid || got.ID != msg.ID {
+		t.Errorf("unexpected verified message %+v", got)
+	}
+
+	// The order of the fields and the whitespace don't matter.
+	var fields map[string]json.RawMessage
+	json.Unmarshal(data, &fields)
+	indented, _ := json.MarshalIndent(fields, "", "  ")
+	if _, err := Verify(indented, keys); err != nil {
+		t.Errorf("expected reformatted message to be valid but got: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{
+			name:    "Tampered",
+			data:    []byte(strings.Replace(string(data), `"c1"`, `"c2"`, 1)),
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "Unsigned",
+			data:    []byte(`{"action": "abort", "check_id": "c1"}`),
+			wantErr: ErrUnsigned,
+		},
+		{
+			name:    "Unknown key",
+			data:    []byte(strings.Replace(string(data), `"kid":"`+kid+`"`, `"kid":"k0"`, 1)),
+			wantErr: ErrUnknownKey,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Verify(tc.data, keys); !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected error %v but got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSignedStream(t *testing.T) {
+	keyFile, _ := writeKey(t, t.TempDir(), "key")
+	k, err := LoadKeyring(SenderConfig{SigningKeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("expected no error loading keyring but got: %v", err)
+	}
+
+	logger := log.New()
+	s := NewSender(logger, SenderConfig{HTTPStream: "stream"})
+	s.SetKeyring(k)
+	api := NewAPI(0, s, mockStorage{}, logger, nil)
+	srv := httptest.NewServer(api.mux)
+	defer srv.Close()
+
+	keys, err := FetchKeys(context.Background(), srv.URL+"/keys")
+	if err != nil {
+		t.Fatalf("expected no error fetching keys but got: %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream", nil)
+	if err != nil {
+		t.Fatalf("expected no error connecting but got: %v", err)
+	}
+	defer conn.Close()
+	waitSubscribers(t, s, 1)
+
+	s.Broadcast(context.Background(), Message{CheckID: "c1", Action: actionAbort})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("expected no error reading message but got: %v", err)
+	}
+	msg, err := Verify(data, keys)
+	if err != nil {
+		t.Fatalf("expected valid signature but got: %v", err)
+	}
+	if msg.KeyID != KeyID(k.key.Public().(ed25519.PublicKey)) {
+		t.Errorf("expected message signed with the default key ID but got %q", msg.KeyID)
+	}
+}
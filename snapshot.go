@@ -0,0 +1,109 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defSnapshotInterval = 60 // seconds
+
+// snapshot is the on-disk representation of the storage local cache.
+type snapshot struct {
+	Checks   []string  `json:"checks"`
+	Pending  []string  `json:"pending,omitempty"`
+	LastSync time.Time `json:"last_sync"`
+	Created  time.Time `json:"created_at"`
+}
+
+// readSnapshot reads the snapshot stored in path. It returns
+// a nil snapshot and no error if the file does not exist.
+func readSnapshot(path string) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// writeSnapshot atomically replaces the snapshot stored in path by snap.
+func writeSnapshot(path string, snap snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() // nolint
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close() // nolint
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadSnapshot fills the local cache from the snapshot file.
+// It reports whether a snapshot was found.
+func (s *storage) loadSnapshot() (bool, error) {
+	snap, err := readSnapshot(s.snapshotFile)
+	if err != nil || snap == nil {
+		return false, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.cache = merge(snap.Checks, snap.Pending)
+	s.pending = snap.Pending
+	s.lastSync = snap.LastSync
+	promCacheSize.Set(float64(len(s.cache)))
+	promPendingWrites.Set(float64(len(s.pending)))
+	return true, nil
+}
+
+// saveSnapshot writes the local cache to the snapshot file.
+func (s *storage) saveSnapshot() error {
+	s.RLock()
+	snap := snapshot{
+		Checks:   append([]string(nil), s.cache...),
+		Pending:  append([]string(nil), s.pending...),
+		LastSync: s.lastSync,
+		Created:  time.Now(),
+	}
+	s.RUnlock()
+
+	return writeSnapshot(s.snapshotFile, snap)
+}
+
+// snapshotLoop periodically writes the local cache to the snapshot file.
+func (s *storage) snapshotLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.saveSnapshot(); err != nil {
+			s.log.WithError(err).Error("error writing cache snapshot")
+		}
+	}
+}
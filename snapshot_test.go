@@ -0,0 +1,95 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	snap, err := readSnapshot(path)
+	if err != nil || snap != nil {
+		t.Fatalf("expected no snapshot and no error but got: %v, %v", snap, err)
+	}
+
+	want := snapshot{
+		Checks:   []string{"checkID1", "checkID2"},
+		Pending:  []string{"checkID2"},
+		LastSync: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := writeSnapshot(path, want); err != nil {
+		t.Fatalf("expected no error writing snapshot but got: %v", err)
+	}
+
+	snap, err = readSnapshot(path)
+	if err != nil {
+		t.Fatalf("expected no error reading snapshot but got: %v", err)
+	}
+	if !reflect.DeepEqual(*snap, want) {
+		t.Fatalf("expected snapshot to be:\n%+v\nbut got:\n%+v", want, *snap)
+	}
+}
+
+func TestNewStorageFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	lastSync := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	err := writeSnapshot(path, snapshot{
+		Checks:   []string{"checkID1", "checkID2"},
+		LastSync: lastSync,
+	})
+	if err != nil {
+		t.Fatalf("expected no error writing snapshot but got: %v", err)
+	}
+
+	remoteUp := make(chan struct{})
+	db := mockRemoteDB{
+		getChecksF: func(context.Context) ([]string, error) {
+			select {
+			case <-remoteUp:
+				return []string{"checkID1", "checkID3"}, nil
+			default:
+				return nil, errMockInit
+			}
+		},
+		pingF: func(context.Context) error { return nil },
+	}
+
+	s, err := NewStorage(db, CacheConfig{SnapshotFile: path, ReplayInterval: 1}, log.New())
+	if err != nil {
+		t.Fatalf("expected no error building storage from snapshot but got: %v", err)
+	}
+
+	checks, _ := s.GetAbortedChecks(ctx)
+	if want := []string{"checkID1", "checkID2"}; !reflect.DeepEqual(checks, want) {
+		t.Fatalf("expected checks to be:\n%v\nbut got:\n%v", want, checks)
+	}
+	if st := s.Status(ctx); !st.LastSync.Equal(lastSync) {
+		t.Fatalf("expected last sync to be %s but got %s", lastSync, st.LastSync)
+	}
+
+	close(remoteUp)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Status(ctx).LastSync.Equal(lastSync) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected snapshot to be reconciled with remote checks")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	checks, _ = s.GetAbortedChecks(ctx)
+	if want := []string{"checkID1", "checkID3", "checkID2"}; !reflect.DeepEqual(checks, want) {
+		t.Fatalf("expected checks to be:\n%v\nbut got:\n%v", want, checks)
+	}
+}
@@ -6,12 +6,19 @@ package stream
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	redis "github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -19,72 +26,220 @@ const (
 	defTTL          = 7 * 24 // 7 days (hours)
 	rfshPeriod      = 1 * 24 // 1 day (hours)
 	defScanChunk    = 50     // elements per redis SCAN chunk
+
+	defReplayInterval = 10    // seconds
+	defMaxPending     = 10000 // checks
 )
 
+// ErrPendingFull is returned when the queue of writes
+// pending to be replayed in degraded mode is full.
+var ErrPendingFull = errors.New("too many checks pending to be written to remote DB")
+
+// ErrDegraded is returned when revoking aborted checks while the
+// remote DB is unavailable, as they would be restored once it is back.
+var ErrDegraded = errors.New("storage in degraded mode")
+
 // RemoteDB represents interface to
 // interact with remote DB.
 type RemoteDB interface {
 	GetChecks(ctx context.Context) ([]string, error)
 	SetChecks(ctx context.Context, checks []string) error
+	DeleteChecks(ctx context.Context, checks []string) error
+	Ping(ctx context.Context) error
 }
 
+// Redis deployment modes.
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
 // RedisConfig specifies the required
 // config for RedisStorage.
 type RedisConfig struct {
 	Host string
 	Port int
 	Usr  string
-	Pwd  string
+	Pwd  string `secret:"true"`
 	DB   int
 	TTL  int
+
+	// Mode is the redis deployment mode: standalone
+	// (default), sentinel or cluster.
+	Mode string
+	// Addrs are the host:port addresses of the sentinels or
+	// the cluster nodes. If empty, Host and Port are used.
+	Addrs []string
+	// MasterName is the name of the master
+	// monitored by the sentinels.
+	MasterName  string
+	SentinelUsr string
+	SentinelPwd string `secret:"true"`
+
+	// TLS enables TLS connections to redis.
+	TLS bool
+	// TLSCAFile is the PEM file with the CAs used to verify the
+	// redis certificates. If empty, the system CAs are used.
+	TLSCAFile     string
+	TLSServerName string
+	TLSSkipVerify bool
 }
 
 // RedisDB is the implementation of
 // a RemoteDB for a Redis database.
 type RedisDB struct {
-	rdb *redis.Client
-	ttl time.Duration
+	rdb redis.UniversalClient
+	// ttl is the time.Duration applied to new
+	// entries. It can be changed at runtime.
+	ttl atomic.Int64
 }
 
 // NewRedisDB builds a new redis DB connector.
-func NewRedisDB(c RedisConfig) *RedisDB {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:             fmt.Sprint(c.Host, ":", c.Port),
-		Username:         c.Usr,
-		Password:         c.Pwd,
-		DB:               c.DB,
-		DialTimeout:      time.Second * 10,
-		DisableIndentity: true, // Fixes https://github.com/redis/go-redis/pull/2880
-	})
+func NewRedisDB(c RedisConfig) (*RedisDB, error) {
+	tlsConfig, err := redisTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
 
-	if c.TTL == 0 {
-		c.TTL = defTTL
+	addrs := c.Addrs
+	if len(addrs) == 0 {
+		addrs = []string{fmt.Sprint(c.Host, ":", c.Port)}
 	}
 
-	return &RedisDB{
-		rdb: rdb,
-		ttl: time.Duration(c.TTL) * time.Hour,
+	var rdb redis.UniversalClient
+	switch c.Mode {
+	case "", RedisModeStandalone:
+		rdb = redis.NewClient(&redis.Options{
+			Addr:             addrs[0],
+			Username:         c.Usr,
+			Password:         c.Pwd,
+			DB:               c.DB,
+			DialTimeout:      time.Second * 10,
+			TLSConfig:        tlsConfig,
+			DisableIndentity: true, // Fixes https://github.com/redis/go-redis/pull/2880
+		})
+	case RedisModeSentinel:
+		if c.MasterName == "" {
+			return nil, errors.New("redis sentinel mode requires a master name")
+		}
+		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       c.MasterName,
+			SentinelAddrs:    addrs,
+			SentinelUsername: c.SentinelUsr,
+			SentinelPassword: c.SentinelPwd,
+			Username:         c.Usr,
+			Password:         c.Pwd,
+			DB:               c.DB,
+			DialTimeout:      time.Second * 10,
+			TLSConfig:        tlsConfig,
+			DisableIndentity: true,
+		})
+	case RedisModeCluster:
+		if c.DB != 0 {
+			return nil, errors.New("redis cluster mode only supports DB 0")
+		}
+		rdb = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:            addrs,
+			Username:         c.Usr,
+			Password:         c.Pwd,
+			DialTimeout:      time.Second * 10,
+			TLSConfig:        tlsConfig,
+			DisableIndentity: true,
+		})
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", c.Mode)
 	}
+
+	db := &RedisDB{rdb: rdb}
+	db.SetTTL(c.TTL)
+
+	return db, nil
+}
+
+// SetTTL sets the TTL, in hours, of the checks stored from now on.
+// If ttl is 0, the default TTL is used.
+func (r *RedisDB) SetTTL(ttl int) {
+	if ttl == 0 {
+		ttl = defTTL
+	}
+	r.ttl.Store(int64(time.Duration(ttl) * time.Hour))
+}
+
+// redisTLSConfig returns the TLS config to connect to
+// redis, or nil if TLS is not enabled.
+func redisTLSConfig(c RedisConfig) (*tls.Config, error) {
+	if !c.TLS {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSSkipVerify, // nolint: gosec
+	}
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("err reading redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", c.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
 }
 
 // GetChecks returns checks stored in redis.
-func (r *RedisDB) GetChecks(ctx context.Context) ([]string, error) {
+//
+// In cluster mode the checks keys are spread across the
+// masters, so every master is scanned for them.
+func (r *RedisDB) GetChecks(ctx context.Context) (checks []string, err error) {
+	defer func(start time.Time) { observeStorageOp("get_checks", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.GetChecks", attribute.String("db.system", "redis"))
+	defer func() { endSpan(span, err) }()
+
+	cc, ok := r.rdb.(*redis.ClusterClient)
+	if !ok {
+		return scanChecks(ctx, r.rdb)
+	}
+
+	var mu sync.Mutex
+	checks = []string{}
+	err = cc.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		nodeChecks, err := scanChecks(ctx, client)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		checks = append(checks, nodeChecks...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+// scanChecks returns the checks stored in the given redis node.
+func scanChecks(ctx context.Context, c redis.Cmdable) ([]string, error) {
 	var (
 		err    error
 		cursor uint64
-		checks []string
 	)
 
-	checks = []string{}
+	checks := []string{}
 	match := fmt.Sprint(checksKeyPrefix, "*")
 	for {
 		var keys []string
-		keys, cursor, err = r.rdb.Scan(ctx, cursor, match, defScanChunk).Result()
+		keys, cursor, err = c.Scan(ctx, cursor, match, defScanChunk).Result()
 		if err != nil {
 			return nil, err
 		}
 		for _, k := range keys {
-			checkID, err := r.rdb.Get(ctx, k).Result()
+			checkID, err := c.Get(ctx, k).Result()
 			if err != nil {
 				return nil, err
 			}
@@ -99,19 +254,101 @@ func (r *RedisDB) GetChecks(ctx context.Context) ([]string, error) {
 }
 
 // SetChecks sets input checks in redis as a single transaction.
-func (r *RedisDB) SetChecks(ctx context.Context, checks []string) error {
-	pipe := r.rdb.TxPipeline()
-	for _, c := range checks {
-		key := fmt.Sprint(checksKeyPrefix, c)
-		err := pipe.Set(ctx, key, c, r.ttl).Err()
-		if err != nil {
-			pipe.Discard() // nolint
+// In cluster mode, a transaction is run for every hash slot the
+// checks keys belong to.
+func (r *RedisDB) SetChecks(ctx context.Context, checks []string) (err error) {
+	defer func(start time.Time) { observeStorageOp("set_checks", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.SetChecks",
+		attribute.String("db.system", "redis"),
+		attribute.Int("stream.checks", len(checks)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	ttl := time.Duration(r.ttl.Load())
+	return r.checksTx(ctx, checks, func(pipe redis.Pipeliner, key, check string) {
+		pipe.Set(ctx, key, check, ttl)
+	})
+}
+
+// DeleteChecks deletes input checks from redis as a single
+// transaction, in the same way as SetChecks.
+func (r *RedisDB) DeleteChecks(ctx context.Context, checks []string) (err error) {
+	defer func(start time.Time) { observeStorageOp("delete_checks", start, err) }(time.Now())
+	ctx, span := startSpan(ctx, "RedisDB.DeleteChecks",
+		attribute.String("db.system", "redis"),
+		attribute.Int("stream.checks", len(checks)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	return r.checksTx(ctx, checks, func(pipe redis.Pipeliner, key, _ string) {
+		pipe.Del(ctx, key)
+	})
+}
+
+// checksTx queues the commands added by f for every check, given
+// its key, in a transaction. In cluster mode, as a transaction can
+// only touch keys of the same hash slot, the checks are grouped
+// by slot and a transaction is run for every group.
+func (r *RedisDB) checksTx(ctx context.Context, checks []string, f func(pipe redis.Pipeliner, key, check string)) error {
+	groups := [][]string{checks}
+	if _, ok := r.rdb.(*redis.ClusterClient); ok {
+		groups = groupBySlot(checks)
+	}
+	for _, group := range groups {
+		pipe := r.rdb.TxPipeline()
+		for _, c := range group {
+			f(pipe, fmt.Sprint(checksKeyPrefix, c), c)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	_, err := pipe.Exec(ctx)
-	return err
+// groupBySlot groups the checks by the cluster hash slot of
+// their keys, keeping the order in which the slots appear.
+func groupBySlot(checks []string) [][]string {
+	var groups [][]string
+	index := make(map[uint16]int)
+	for _, c := range checks {
+		slot := clusterSlot(fmt.Sprint(checksKeyPrefix, c))
+		i, ok := index[slot]
+		if !ok {
+			i = len(groups)
+			index[slot] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], c)
+	}
+	return groups
+}
+
+// clusterSlot returns the Redis Cluster hash slot of key: the
+// CRC16 of the key, or of its hash tag if it has one, modulo 16384.
+func clusterSlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc % 16384
+}
+
+// Ping checks the connection to redis.
+func (r *RedisDB) Ping(ctx context.Context) error {
+	return r.rdb.Ping(ctx).Err()
 }
 
 // Storage represents the stream storage
@@ -119,6 +356,49 @@ func (r *RedisDB) SetChecks(ctx context.Context, checks []string) error {
 type Storage interface {
 	GetAbortedChecks(ctx context.Context) ([]string, error)
 	AddAbortedChecks(ctx context.Context, checks []string) error
+	RemoveAbortedChecks(ctx context.Context, checks []string) error
+	Status(ctx context.Context) StorageStatus
+}
+
+// StorageStatus describes the health of the storage.
+type StorageStatus struct {
+	// RemoteErr is the error returned when reaching
+	// the remote DB, or nil if it is reachable.
+	RemoteErr error
+	// CacheSize is the number of checks in the local cache.
+	CacheSize int
+	// LastSync is the last time the local cache
+	// was successfully loaded from the remote DB.
+	LastSync time.Time
+	// Degraded is true while the storage is accepting
+	// checks without writing them to the remote DB.
+	Degraded bool
+	// Pending is the number of checks queued to
+	// be written to the remote DB.
+	Pending int
+}
+
+// CacheConfig specifies the behaviour of
+// the storage local cache.
+type CacheConfig struct {
+	// Degraded enables the degraded mode. When enabled, the stream
+	// starts even if the remote DB is unavailable and aborted checks
+	// are accepted into the local cache and queued to be written to
+	// the remote DB once it is reachable again.
+	Degraded bool
+	// ReplayInterval is the number of seconds between
+	// attempts to replay the queued writes.
+	ReplayInterval int
+	// MaxPending is the maximum number of checks
+	// that can be queued while in degraded mode.
+	MaxPending int
+	// SnapshotFile is the path of the file the local cache is
+	// periodically written to. If set, the cache is loaded from
+	// the file at startup and then reconciled with the remote DB.
+	SnapshotFile string
+	// SnapshotInterval is the number of seconds
+	// between snapshots of the local cache.
+	SnapshotInterval int
 }
 
 // cache is a local cache for
@@ -131,27 +411,91 @@ type storage struct {
 	// Because a current constraint for stream is that
 	// it runs as a single instance, we can mantain a local
 	// cache in sync with remote storage to speed up retrivals.
-	cache cache
-	log   log.FieldLogger
+	cache    cache
+	lastSync time.Time
+	log      log.FieldLogger
+
+	// degradedMode is set when the degraded mode
+	// is enabled in the config, while degraded is
+	// set while the remote DB is unavailable.
+	degradedMode bool
+	degraded     bool
+	// pending are the checks accepted in degraded
+	// mode that have not been written to remote DB.
+	pending    []string
+	maxPending int
+	// syncMu serializes the syncs with the remote DB, so the
+	// pending checks written by one are not trimmed by another.
+	syncMu sync.Mutex
+
+	snapshotFile string
 }
 
 // NewStorage builds a new Storage.
-func NewStorage(db RemoteDB, logger log.FieldLogger) (Storage, error) {
+//
+// If a snapshot of the local cache is available, the storage is
+// built from it and reconciled with the remote DB in background.
+// Otherwise, the local cache is loaded from the remote DB.
+func NewStorage(db RemoteDB, c CacheConfig, logger log.FieldLogger) (Storage, error) {
+	if c.ReplayInterval == 0 {
+		c.ReplayInterval = defReplayInterval
+	}
+	if c.MaxPending == 0 {
+		c.MaxPending = defMaxPending
+	}
+	if c.SnapshotInterval == 0 {
+		c.SnapshotInterval = defSnapshotInterval
+	}
+	retry := time.Duration(c.ReplayInterval) * time.Second
+
 	storage := &storage{
-		db:    db,
-		cache: cache{},
-		log:   logger,
+		db:           db,
+		cache:        cache{},
+		log:          logger,
+		degradedMode: c.Degraded,
+		maxPending:   c.MaxPending,
+		snapshotFile: c.SnapshotFile,
 	}
 
-	var err error
-	start := time.Now()
-	storage.cache, err = storage.db.GetChecks(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("err retrieving remote checks in %s: %w", time.Since(start), err)
+	var fromSnapshot bool
+	if c.SnapshotFile != "" {
+		var err error
+		start := time.Now()
+		fromSnapshot, err = storage.loadSnapshot()
+		if err != nil {
+			logger.WithError(err).Error("error loading cache snapshot")
+		} else if fromSnapshot {
+			logger.Debugf("Loaded %d checks from snapshot in %s", len(storage.cache), time.Since(start))
+		}
+	}
+
+	if fromSnapshot {
+		go storage.reconcile(retry)
+	} else {
+		start := time.Now()
+		checks, err := storage.db.GetChecks(context.Background())
+		if err != nil {
+			err = fmt.Errorf("err retrieving remote checks in %s: %w", time.Since(start), err)
+			if !c.Degraded {
+				return nil, err
+			}
+			logger.WithError(err).Warn("Starting storage in degraded mode")
+			storage.setDegraded(true)
+		} else {
+			storage.cache = checks
+			storage.lastSync = time.Now()
+			logger.Debugf("Loaded %d remote checks in %s", len(storage.cache), time.Since(start))
+		}
+		promCacheSize.Set(float64(len(storage.cache)))
 	}
-	logger.Debugf("Loaded %d remote checks in %s", len(storage.cache), time.Since(start))
 
 	go storage.refresh()
+	if c.Degraded {
+		go storage.replayLoop(retry)
+	}
+	if c.SnapshotFile != "" {
+		go storage.snapshotLoop(time.Duration(c.SnapshotInterval) * time.Second)
+	}
 
 	return storage, nil
 }
@@ -168,20 +512,213 @@ func (s *storage) GetAbortedChecks(ctx context.Context) ([]string, error) {
 }
 
 // AddAbortedChecks adds the given checks to the current aborted checks list.
-func (s *storage) AddAbortedChecks(ctx context.Context, checks []string) error {
+//
+// In degraded mode, if the checks can not be written to the remote DB they
+// are added to the local cache and queued to be written later.
+func (s *storage) AddAbortedChecks(ctx context.Context, checks []string) (err error) {
+	ctx, span := startSpan(ctx, "storage.AddAbortedChecks", attribute.Int("stream.checks", len(checks)))
+	defer func() { endSpan(span, err) }()
+
 	s.Lock()
 	defer s.Unlock()
 
+	// While degraded, do not wait for the remote
+	// DB to time out on every request, just queue
+	// the checks so they are replayed in order.
+	if s.degraded {
+		return s.enqueue(checks)
+	}
+
 	// Because we have mantained local cache in sync
 	// with remote storage, we can add new checks to
 	// local cache and set that value in remote DB
 	// instead of performing extra requests to retrieve
 	// all remote values.
-	err := s.db.SetChecks(ctx, checks)
+	err = s.db.SetChecks(ctx, checks)
 	if err != nil {
+		if !s.degradedMode {
+			return err
+		}
+		s.log.WithError(err).Warn("Remote DB unavailable, entering degraded mode")
+		s.setDegraded(true)
+		return s.enqueue(checks)
+	}
+	s.cache = append(s.cache, checks...)
+	promCacheSize.Set(float64(len(s.cache)))
+
+	return nil
+}
+
+// RemoveAbortedChecks removes the given checks from the current aborted
+// checks list. It fails with ErrDegraded while in degraded mode.
+func (s *storage) RemoveAbortedChecks(ctx context.Context, checks []string) (err error) {
+	ctx, span := startSpan(ctx, "storage.RemoveAbortedChecks", attribute.Int("stream.checks", len(checks)))
+	defer func() { endSpan(span, err) }()
+
+	// Wait for any sync in flight, so it does not write
+	// back, or reload, the checks removed.
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	s.Lock()
+	defer s.Unlock()
+
+	if s.degraded {
+		return ErrDegraded
+	}
+	if err = s.db.DeleteChecks(ctx, checks); err != nil {
 		return err
 	}
+	removed := make(map[string]struct{}, len(checks))
+	for _, c := range checks {
+		removed[c] = struct{}{}
+	}
+	s.cache = without(s.cache, removed)
+	s.pending = without(s.pending, removed)
+	promCacheSize.Set(float64(len(s.cache)))
+	promPendingWrites.Set(float64(len(s.pending)))
+
+	return nil
+}
+
+// without returns the checks not in removed.
+func without(checks []string, removed map[string]struct{}) []string {
+	kept := make([]string, 0, len(checks))
+	for _, c := range checks {
+		if _, ok := removed[c]; !ok {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// Status returns the current status of the storage.
+func (s *storage) Status(ctx context.Context) StorageStatus {
+	err := s.db.Ping(ctx)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	return StorageStatus{
+		RemoteErr: err,
+		CacheSize: len(s.cache),
+		LastSync:  s.lastSync,
+		Degraded:  s.degraded,
+		Pending:   len(s.pending),
+	}
+}
+
+// enqueue adds checks to the local cache and to the queue
+// of pending writes. It must be called with the lock held.
+func (s *storage) enqueue(checks []string) error {
+	if len(s.pending)+len(checks) > s.maxPending {
+		return ErrPendingFull
+	}
+	s.pending = append(s.pending, checks...)
 	s.cache = append(s.cache, checks...)
+	promCacheSize.Set(float64(len(s.cache)))
+	promPendingWrites.Set(float64(len(s.pending)))
+	return nil
+}
+
+// setDegraded sets the degraded state of the
+// storage. It must be called with the lock held.
+func (s *storage) setDegraded(degraded bool) {
+	s.degraded = degraded
+	v := 0.0
+	if degraded {
+		v = 1
+	}
+	promDegraded.Set(v)
+}
+
+// replayLoop periodically tries to recover from degraded mode.
+func (s *storage) replayLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.replay(context.Background()); err != nil {
+			s.log.WithError(err).Warn("Remote DB still unavailable")
+		}
+	}
+}
+
+// replay writes the pending checks to the remote DB and, if the local
+// cache was never loaded, merges the remote checks into it. The storage
+// leaves degraded mode once both operations succeed.
+func (s *storage) replay(ctx context.Context) error {
+	s.RLock()
+	degraded, loaded := s.degraded, !s.lastSync.IsZero()
+	s.RUnlock()
+
+	if !degraded {
+		return nil
+	}
+	return s.sync(ctx, !loaded)
+}
+
+// reconcile syncs the local cache loaded from a snapshot with
+// the remote DB, retrying at the given interval until it succeeds.
+func (s *storage) reconcile(retry time.Duration) {
+	ctx := context.Background()
+	for {
+		start := time.Now()
+		err := s.sync(ctx, true)
+		if err == nil {
+			s.log.Debugf("Reconciled snapshot with remote checks in %s", time.Since(start))
+			return
+		}
+		s.log.WithError(err).Error("error reconciling snapshot with remote checks")
+		if s.degradedMode {
+			s.Lock()
+			s.setDegraded(true)
+			s.Unlock()
+		}
+		time.Sleep(retry)
+	}
+}
+
+// sync writes the pending checks to the remote DB and, if reload is set,
+// merges the remote checks into the local cache. Checks that only exist
+// locally are kept until the next refresh, which is harmless because the
+// checks IDs are never reused.
+func (s *storage) sync(ctx context.Context, reload bool) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	s.RLock()
+	pending := append([]string(nil), s.pending...)
+	s.RUnlock()
+
+	if len(pending) > 0 {
+		if err := s.db.SetChecks(ctx, pending); err != nil {
+			return err
+		}
+	}
+
+	var remote []string
+	if reload {
+		var err error
+		remote, err = s.db.GetChecks(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// Checks queued while syncing stay pending.
+	s.pending = s.pending[len(pending):]
+	promPendingWrites.Set(float64(len(s.pending)))
+	if reload {
+		s.cache = merge(remote, s.cache)
+		s.lastSync = time.Now()
+		promCacheSize.Set(float64(len(s.cache)))
+	}
+	if s.degraded && len(s.pending) == 0 {
+		s.setDegraded(false)
+		s.log.Infof("Remote DB available, replayed %d checks", len(pending))
+	}
 
 	return nil
 }
@@ -189,20 +726,46 @@ func (s *storage) AddAbortedChecks(ctx context.Context, checks []string) error {
 // refresh refreshes the storage's local cache
 // periodically so checks that have been expired
 // remotely due to TTL, are also removed locally.
+//
+// If the refresh fails, the current cache is kept
+// and the time of the last sync is not updated.
 func (s *storage) refresh() {
-	var err error
 	ctx := context.Background()
 
 	for {
 		time.Sleep(time.Duration(rfshPeriod) * time.Hour)
 		s.Lock()
 		start := time.Now()
-		s.cache, err = s.db.GetChecks(ctx)
+		checks, err := s.db.GetChecks(ctx)
 		if err != nil {
 			s.log.Errorf("error refreshing remote checks in %s: %v", time.Since(start), err)
 		} else {
+			// Keep the checks that are still
+			// pending to be written remotely.
+			s.cache = merge(checks, s.pending)
+			s.lastSync = time.Now()
 			s.log.Debugf("Refreshed %d remote checks in %s", len(s.cache), time.Since(start))
+			promCacheSize.Set(float64(len(s.cache)))
 		}
 		s.Unlock()
 	}
 }
+
+// merge returns the checks in a followed by the
+// checks in b that are not present in a.
+func merge(a, b []string) []string {
+	seen := make(map[string]struct{}, len(a))
+	merged := make([]string, 0, len(a)+len(b))
+	for _, c := range a {
+		seen[c] = struct{}{}
+		merged = append(merged, c)
+	}
+	for _, c := range b {
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		merged = append(merged, c)
+	}
+	return merged
+}
@@ -7,10 +7,15 @@ package stream
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"slices"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	redis "github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -20,8 +25,10 @@ var (
 )
 
 type mockRemoteDB struct {
-	getChecksF func(context.Context) ([]string, error)
-	setChecksF func(context.Context, []string) error
+	getChecksF    func(context.Context) ([]string, error)
+	setChecksF    func(context.Context, []string) error
+	deleteChecksF func(context.Context, []string) error
+	pingF         func(context.Context) error
 }
 
 func (m mockRemoteDB) GetChecks(ctx context.Context) ([]string, error) {
@@ -30,6 +37,12 @@ func (m mockRemoteDB) GetChecks(ctx context.Context) ([]string, error) {
 func (m mockRemoteDB) SetChecks(ctx context.Context, checks []string) error {
 	return m.setChecksF(ctx, checks)
 }
+func (m mockRemoteDB) DeleteChecks(ctx context.Context, checks []string) error {
+	return m.deleteChecksF(ctx, checks)
+}
+func (m mockRemoteDB) Ping(ctx context.Context) error {
+	return m.pingF(ctx)
+}
 
 func TestGetAbortedChecks(t *testing.T) {
 	testCases := []struct {
@@ -65,7 +78,7 @@ func TestGetAbortedChecks(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(*testing.T) {
-			storage, err := NewStorage(tc.db, log)
+			storage, err := NewStorage(tc.db, CacheConfig{}, log)
 			if !errors.Is(err, tc.wantInitErr) {
 				t.Fatalf("expected init err to be: %v\nbut got: %v", tc.wantInitErr, err)
 			}
@@ -135,6 +148,67 @@ func TestAddAbortedChecks(t *testing.T) {
 	}
 }
 
+func TestRemoveAbortedChecks(t *testing.T) {
+	testCases := []struct {
+		name         string
+		db           mockRemoteDB
+		degraded     bool
+		revokeChecks []string
+		wantCache    cache
+		wantErr      error
+	}{
+		{
+			name: "Happy path",
+			db: mockRemoteDB{
+				deleteChecksF: func(ctx context.Context, checks []string) error {
+					return nil
+				},
+			},
+			revokeChecks: []string{"checkID1", "checkID3"},
+			wantCache:    []string{"checkID2"},
+		},
+		{
+			name: "Error on delete",
+			db: mockRemoteDB{
+				deleteChecksF: func(ctx context.Context, checks []string) error {
+					return errMockSet
+				},
+			},
+			revokeChecks: []string{"checkID1"},
+			wantCache:    []string{"checkID1", "checkID2"},
+			wantErr:      errMockSet,
+		},
+		{
+			name:         "Degraded",
+			degraded:     true,
+			revokeChecks: []string{"checkID1"},
+			wantCache:    []string{"checkID1", "checkID2"},
+			wantErr:      ErrDegraded,
+		},
+	}
+
+	ctx := context.Background()
+	log := log.New()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(*testing.T) {
+			storage := storage{
+				db:       tc.db,
+				cache:    cache{"checkID1", "checkID2"},
+				log:      log,
+				degraded: tc.degraded,
+			}
+			err := storage.RemoveAbortedChecks(ctx, tc.revokeChecks)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected err to be: %v\nbut got: %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(tc.wantCache, storage.cache) {
+				t.Fatalf("expected local cache to be:\n%v\nbut got:\n%v", tc.wantCache, storage.cache)
+			}
+		})
+	}
+}
+
 func TestConcurrentRW(t *testing.T) {
 	ctx := context.Background()
 	log := log.New()
@@ -168,3 +242,358 @@ func TestConcurrentRW(t *testing.T) {
 	}
 
 }
+
+func TestDegradedMode(t *testing.T) {
+	ctx := context.Background()
+	log := log.New()
+
+	remoteUp := false
+	remote := []string{"checkID1"}
+	db := mockRemoteDB{
+		getChecksF: func(context.Context) ([]string, error) {
+			if !remoteUp {
+				return nil, errMockInit
+			}
+			return remote, nil
+		},
+		setChecksF: func(ctx context.Context, checks []string) error {
+			if !remoteUp {
+				return errMockSet
+			}
+			remote = append(remote, checks...)
+			return nil
+		},
+		pingF: func(context.Context) error { return nil },
+	}
+
+	s, err := NewStorage(db, CacheConfig{Degraded: true, ReplayInterval: 3600}, log)
+	if err != nil {
+		t.Fatalf("expected no init error in degraded mode but got: %v", err)
+	}
+	if st := s.Status(ctx); !st.Degraded {
+		t.Fatalf("expected storage to be degraded")
+	}
+
+	if err := s.AddAbortedChecks(ctx, []string{"checkID2"}); err != nil {
+		t.Fatalf("expected no error adding checks in degraded mode but got: %v", err)
+	}
+	checks, _ := s.GetAbortedChecks(ctx)
+	if want := []string{"checkID2"}; !reflect.DeepEqual(checks, want) {
+		t.Fatalf("expected checks to be:\n%v\nbut got:\n%v", want, checks)
+	}
+
+	storage := s.(*storage)
+	if err := storage.replay(ctx); !errors.Is(err, errMockSet) {
+		t.Fatalf("expected replay err to be: %v\nbut got: %v", errMockSet, err)
+	}
+
+	remoteUp = true
+	if err := storage.replay(ctx); err != nil {
+		t.Fatalf("expected no replay error but got: %v", err)
+	}
+	st := s.Status(ctx)
+	if st.Degraded || st.Pending != 0 || st.LastSync.IsZero() {
+		t.Fatalf("expected storage to have recovered but got status: %+v", st)
+	}
+	checks, _ = s.GetAbortedChecks(ctx)
+	if want := []string{"checkID1", "checkID2"}; !reflect.DeepEqual(checks, want) {
+		t.Fatalf("expected checks to be:\n%v\nbut got:\n%v", want, checks)
+	}
+	if want := []string{"checkID1", "checkID2"}; !reflect.DeepEqual(remote, want) {
+		t.Fatalf("expected remote checks to be:\n%v\nbut got:\n%v", want, remote)
+	}
+}
+
+func TestConcurrentSync(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu     sync.Mutex
+		writes int
+		remote []string
+	)
+	db := mockRemoteDB{
+		getChecksF: func(context.Context) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), remote...), nil
+		},
+		setChecksF: func(ctx context.Context, checks []string) error {
+			mu.Lock()
+			writes++
+			fail := writes <= 4
+			mu.Unlock()
+			// Fail the first writes so both the reconcile and
+			// the replay are retrying when the DB is back.
+			if fail {
+				return errMockSet
+			}
+			time.Sleep(10 * time.Millisecond) // mock write time
+			mu.Lock()
+			remote = append(remote, checks...)
+			mu.Unlock()
+			return nil
+		},
+		pingF: func(context.Context) error { return nil },
+	}
+
+	s := &storage{
+		db:           db,
+		cache:        cache{},
+		log:          log.New(),
+		degradedMode: true,
+		maxPending:   1000,
+	}
+	s.setDegraded(true)
+
+	var want []string
+	add := func(i int) {
+		check := fmt.Sprintf("checkID%d", i)
+		if err := s.AddAbortedChecks(ctx, []string{check}); err != nil {
+			t.Fatalf("expected no error adding checks but got: %v", err)
+		}
+		want = append(want, check)
+	}
+	for i := 0; i < 10; i++ {
+		add(i)
+	}
+
+	// Drive the snapshot reconcile and the
+	// replay loop at the same time.
+	go s.reconcile(time.Millisecond)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			s.replay(ctx) // nolint
+		}
+	}()
+
+	for i := 10; i < 100; i++ {
+		add(i)
+		time.Sleep(100 * time.Microsecond)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := s.Status(ctx)
+		if !st.Degraded && st.Pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected storage to have recovered but got status: %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	got := append([]string(nil), remote...)
+	mu.Unlock()
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected remote checks to be:\n%v\nbut got:\n%v", want, got)
+	}
+}
+
+func TestRemoveDuringReconcile(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu     sync.Mutex
+		remote = []string{"checkID2"}
+	)
+	writing := make(chan struct{})
+	release := make(chan struct{})
+	db := mockRemoteDB{
+		getChecksF: func(context.Context) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), remote...), nil
+		},
+		setChecksF: func(ctx context.Context, checks []string) error {
+			close(writing)
+			<-release
+			mu.Lock()
+			defer mu.Unlock()
+			remote = append(remote, checks...)
+			return nil
+		},
+		deleteChecksF: func(ctx context.Context, checks []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			remote = slices.DeleteFunc(remote, func(c string) bool { return slices.Contains(checks, c) })
+			return nil
+		},
+		pingF: func(context.Context) error { return nil },
+	}
+
+	// The snapshot has checkID1 pending to be written.
+	s := &storage{
+		db:         db,
+		cache:      cache{"checkID1", "checkID2"},
+		pending:    []string{"checkID1"},
+		log:        log.New(),
+		maxPending: 1000,
+	}
+	reconciled := make(chan struct{})
+	go func() {
+		s.reconcile(time.Millisecond)
+		close(reconciled)
+	}()
+
+	// Revoke checkID1 while it is being written.
+	<-writing
+	removed := make(chan error)
+	go func() {
+		removed <- s.RemoveAbortedChecks(ctx, []string{"checkID1"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-removed; err != nil {
+		t.Fatalf("expected no error removing checks but got: %v", err)
+	}
+	<-reconciled
+
+	want := []string{"checkID2"}
+	checks, _ := s.GetAbortedChecks(ctx)
+	if !reflect.DeepEqual([]string(checks), want) {
+		t.Errorf("expected local cache to be:\n%v\nbut got:\n%v", want, checks)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(remote, want) {
+		t.Errorf("expected remote checks to be:\n%v\nbut got:\n%v", want, remote)
+	}
+	if st := s.Status(ctx); st.Pending != 0 {
+		t.Errorf("expected no pending checks but got %d", st.Pending)
+	}
+}
+
+func TestClusterSlot(t *testing.T) {
+	// The slots are the ones returned by CLUSTER KEYSLOT.
+	testCases := []struct {
+		key  string
+		want uint16
+	}{
+		{key: "123456789", want: 12739},
+		{key: "foo", want: 12182},
+		{key: "bar", want: 5061},
+		{key: "{user1000}.following", want: 3443},
+		{key: "{user1000}.followers", want: 3443},
+		{key: "foo{}{bar}", want: 8363},
+		{key: "foo{{bar}}zap", want: 4015},
+	}
+	for _, tc := range testCases {
+		if got := clusterSlot(tc.key); got != tc.want {
+			t.Errorf("expected slot of %q to be %d but got %d", tc.key, tc.want, got)
+		}
+	}
+}
+
+func TestGroupBySlot(t *testing.T) {
+	checks := make([]string, 100)
+	for i := range checks {
+		checks[i] = fmt.Sprintf("checkID%d", i)
+	}
+	groups := groupBySlot(checks)
+	if len(groups) < 2 {
+		t.Fatalf("expected checks spread across slots but got %d groups", len(groups))
+	}
+
+	var got []string
+	slots := make(map[uint16]bool)
+	for _, g := range groups {
+		slot := clusterSlot(checksKeyPrefix + g[0])
+		if slots[slot] {
+			t.Errorf("expected a single group for slot %d", slot)
+		}
+		slots[slot] = true
+		for _, c := range g {
+			if s := clusterSlot(checksKeyPrefix + c); s != slot {
+				t.Errorf("expected check %s in slot %d but got %d", c, slot, s)
+			}
+		}
+		got = append(got, g...)
+	}
+	sort.Strings(got)
+	want := append([]string(nil), checks...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected every check grouped once but got %v", got)
+	}
+}
+
+func TestNewRedisDB(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     RedisConfig
+		wantClient interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "Standalone",
+			config:     RedisConfig{Host: "127.0.0.1", Port: 6379},
+			wantClient: &redis.Client{},
+		},
+		{
+			name: "Sentinel",
+			config: RedisConfig{
+				Mode:       RedisModeSentinel,
+				Addrs:      []string{"sentinel1:26379", "sentinel2:26379"},
+				MasterName: "mymaster",
+			},
+			wantClient: &redis.Client{},
+		},
+		{
+			name:    "Sentinel without master name",
+			config:  RedisConfig{Mode: RedisModeSentinel, Addrs: []string{"sentinel1:26379"}},
+			wantErr: true,
+		},
+		{
+			name: "Cluster",
+			config: RedisConfig{
+				Mode:  RedisModeCluster,
+				Addrs: []string{"node1:6379", "node2:6379"},
+				TLS:   true,
+			},
+			wantClient: &redis.ClusterClient{},
+		},
+		{
+			name:    "Cluster with DB",
+			config:  RedisConfig{Mode: RedisModeCluster, Addrs: []string{"node1:6379"}, DB: 1},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown mode",
+			config:  RedisConfig{Mode: "replicated"},
+			wantErr: true,
+		},
+		{
+			name:    "Missing CA file",
+			config:  RedisConfig{Host: "127.0.0.1", Port: 6379, TLS: true, TLSCAFile: "missing.pem"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := NewRedisDB(tc.config)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error: %v\nbut got: %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			defer db.rdb.Close()
+			if got, want := reflect.TypeOf(db.rdb), reflect.TypeOf(tc.wantClient); got != want {
+				t.Fatalf("expected client to be %v but got %v", want, got)
+			}
+		})
+	}
+}
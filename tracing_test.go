@@ -0,0 +1,43 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracedPropagatesTraceParent(t *testing.T) {
+	if _, err := NewTracing(context.Background(), TracingConfig{}); err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parent  = "00-" + traceID + "-00f067aa0ba902b7-01"
+	)
+
+	var got string
+	h := traced("/abort", func(w http.ResponseWriter, r *http.Request) {
+		got = traceParent(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/abort", nil)
+	req.Header.Set("traceparent", parent)
+	h(httptest.NewRecorder(), req)
+
+	if !strings.Contains(got, traceID) {
+		t.Fatalf("expected traceparent to contain trace ID %s but got: %q", traceID, got)
+	}
+}
+
+func TestTraceParentWithoutSpan(t *testing.T) {
+	if got := traceParent(context.Background()); got != "" {
+		t.Fatalf("expected empty traceparent but got: %q", got)
+	}
+}
@@ -0,0 +1,437 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Types of the events delivered to the webhooks.
+const (
+	// EventCheckAborted is sent once the checks are stored as aborted.
+	EventCheckAborted = "check.aborted"
+	// EventAgentConnected is sent when an agent connects to the stream.
+	EventAgentConnected = "agent.connected"
+	// EventAgentDisconnected is sent when an agent leaves the stream.
+	EventAgentDisconnected = "agent.disconnected"
+)
+
+// Headers of the webhook requests.
+const (
+	webhookEventHeader     = "X-Vulcan-Event"
+	webhookDeliveryHeader  = "X-Vulcan-Delivery"
+	webhookTimestampHeader = "X-Vulcan-Timestamp"
+	webhookSignatureHeader = "X-Vulcan-Signature"
+)
+
+// errWebhookQueueFull is the error of the events dead lettered
+// because the queue of the webhook was full.
+var errWebhookQueueFull = errors.New("webhook queue full")
+
+// WebhooksConfig defines the webhooks notified of the stream events.
+type WebhooksConfig struct {
+	// File is a TOML file with the webhooks, each of them in a
+	// [[Webhook]] table. No webhook is notified if empty.
+	File string
+	// MaxRetries is the number of times a failed delivery is retried
+	// before the event is added to the dead letters. Defaults to 5.
+	MaxRetries int
+	// Backoff is the number of seconds before the first retry,
+	// doubled on every retry up to MaxBackoff. Defaults to 1 and 60.
+	Backoff    int
+	MaxBackoff int
+	// Timeout is the number of seconds a delivery can take. Defaults to 10.
+	Timeout int
+	// QueueSize is the number of events queued for each webhook, and of
+	// dead letters queued to be stored. The events that don't fit are
+	// added to the dead letters, or dropped if they don't fit either.
+	// Defaults to 1000.
+	QueueSize int
+	// DeadLetterKey is the key of the Redis list of the
+	// dead letters. Defaults to vulcan-stream:webhooks:dead.
+	DeadLetterKey string
+	// MaxDeadLetters is the number of dead letters kept.
+	// Zero keeps all of them. Defaults to 1000.
+	MaxDeadLetters int64
+}
+
+// WebhookConfig defines a webhook, as read from the webhooks file.
+type WebhookConfig struct {
+	// Name identifies the webhook in the logs, metrics and dead letters.
+	Name string
+	URL  string
+	// Secret is the key of the HMAC signature of the requests. If
+	// SecretEnv is set, the secret is read from that environment
+	// variable instead.
+	Secret    string
+	SecretEnv string
+	// Events are the types of the events sent to the webhook, e.g.
+	// check.aborted. A trailing * matches any suffix, e.g. agent.*.
+	// Every event is sent if empty.
+	Events []string
+}
+
+// Event is a stream event delivered to the webhooks.
+type Event struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	CheckIDs []string  `json:"check_ids,omitempty"`
+	ScanID   string    `json:"scan_id,omitempty"`
+	AgentID  string    `json:"agent_id,omitempty"`
+	Topics   []string  `json:"topics,omitempty"`
+}
+
+// DeadLetter is an event that could not be delivered to a webhook.
+type DeadLetter struct {
+	Webhook  string    `json:"webhook"`
+	Event    Event     `json:"event"`
+	Time     time.Time `json:"time"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+}
+
+// DeadLetters stores the events that could not be delivered.
+type DeadLetters interface {
+	Add(ctx context.Context, d DeadLetter) error
+	// List returns the dead letters, newest first.
+	List(ctx context.Context) ([]DeadLetter, error)
+}
+
+// LoadWebhooks reads the webhooks in the given TOML file.
+func LoadWebhooks(path string) ([]WebhookConfig, error) {
+	var file struct {
+		Webhook []WebhookConfig
+	}
+	md, err := toml.DecodeFile(path, &file)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown keys in %s: %v", path, undecoded)
+	}
+
+	names := make(map[string]bool)
+	for i, h := range file.Webhook {
+		if h.Name == "" || names[h.Name] {
+			return nil, fmt.Errorf("webhook %d in %s: name must be set and unique, got %q", i, path, h.Name)
+		}
+		names[h.Name] = true
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %q: invalid URL %q", h.Name, h.URL)
+		}
+		if h.SecretEnv != "" {
+			file.Webhook[i].Secret = os.Getenv(h.SecretEnv)
+		}
+		if file.Webhook[i].Secret == "" {
+			return nil, fmt.Errorf("webhook %q: a secret is required", h.Name)
+		}
+		for _, e := range h.Events {
+			if !knownEvent(e) {
+				return nil, fmt.Errorf("webhook %q: unknown event %q", h.Name, e)
+			}
+		}
+	}
+	return file.Webhook, nil
+}
+
+// knownEvent reports whether the event filter e
+// matches any of the types of events.
+func knownEvent(e string) bool {
+	for _, t := range []string{EventCheckAborted, EventAgentConnected, EventAgentDisconnected} {
+		if matchEvent(e, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchEvent reports whether the event filter f matches the event type t.
+func matchEvent(f, t string) bool {
+	if prefix, ok := strings.CutSuffix(f, "*"); ok {
+		return strings.HasPrefix(t, prefix)
+	}
+	return f == t
+}
+
+// Webhooks delivers the stream events to the configured webhooks.
+// Every webhook has its own queue, delivered in order by its own
+// goroutine, so a failing webhook does not delay the others.
+type Webhooks struct {
+	hooks      []*webhook
+	cfg        WebhooksConfig
+	backoff    time.Duration
+	maxBackoff time.Duration
+	dead       DeadLetters
+	client     *http.Client
+	logger     logrus.FieldLogger
+
+	// deadQueue holds the dead letters until they are stored,
+	// so notifying an event never waits for the dead letters.
+	deadQueue chan DeadLetter
+}
+
+type webhook struct {
+	WebhookConfig
+	queue chan Event
+}
+
+// NewWebhooks starts delivering the events to hooks. The events
+// that can't be delivered are added to dead.
+func NewWebhooks(c WebhooksConfig, hooks []WebhookConfig, dead DeadLetters, logger logrus.FieldLogger) *Webhooks {
+	w := newWebhooks(c, hooks, dead, logger)
+	w.start()
+	return w
+}
+
+func newWebhooks(c WebhooksConfig, hooks []WebhookConfig, dead DeadLetters, logger logrus.FieldLogger) *Webhooks {
+	w := &Webhooks{
+		cfg:        c,
+		backoff:    time.Duration(c.Backoff) * time.Second,
+		maxBackoff: time.Duration(c.MaxBackoff) * time.Second,
+		dead:       dead,
+		deadQueue:  make(chan DeadLetter, c.QueueSize),
+		client:     &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+		logger:     logger,
+	}
+	for _, h := range hooks {
+		w.hooks = append(w.hooks, &webhook{WebhookConfig: h, queue: make(chan Event, c.QueueSize)})
+	}
+	return w
+}
+
+// start starts the delivery goroutine of every webhook
+// and the one storing the dead letters.
+func (w *Webhooks) start() {
+	for _, h := range w.hooks {
+		go w.run(h)
+	}
+	go w.storeDeadLetters()
+}
+
+// Notify queues e for the webhooks whose filters match its type.
+// It does not block, and it's a no-op on a nil Webhooks.
+func (w *Webhooks) Notify(e Event) {
+	if w == nil {
+		return
+	}
+	if e.ID == "" {
+		e.ID = newUUID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	for _, h := range w.hooks {
+		if !h.accepts(e.Type) {
+			continue
+		}
+		select {
+		case h.queue <- e:
+		default:
+			w.deadLetter(h, e, 0, errWebhookQueueFull)
+		}
+	}
+}
+
+func (h *webhook) accepts(typ string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, f := range h.Events {
+		if matchEvent(f, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// run delivers the events queued for h, retrying the failed
+// deliveries with exponential backoff.
+func (w *Webhooks) run(h *webhook) {
+	for e := range h.queue {
+		attempts, err := retryBackoff(w.backoff, w.maxBackoff, w.cfg.MaxRetries,
+			func() error { return w.deliver(h, e) },
+			func(attempt int, err error) {
+				promWebhookDeliveries.WithLabelValues(h.Name, "retried").Inc()
+				w.logger.WithError(err).WithFields(logrus.Fields{
+					"webhook":  h.Name,
+					"event_id": e.ID,
+					"attempt":  attempt,
+				}).Warn("Webhook delivery failed, retrying")
+			},
+		)
+		if err != nil {
+			w.deadLetter(h, e, attempts, err)
+			continue
+		}
+		promWebhookDeliveries.WithLabelValues(h.Name, "delivered").Inc()
+	}
+}
+
+// deliver posts e to h, signed with its secret.
+func (w *Webhooks) deliver(h *webhook, e Event) (err error) {
+	ctx, span := startSpan(context.Background(), "Webhooks.deliver",
+		attribute.String("stream.webhook", h.Name),
+		attribute.String("stream.event", e.Type),
+	)
+	defer func() { endSpan(span, err) }()
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, e.Type)
+	req.Header.Set(webhookDeliveryHeader, e.ID)
+	req.Header.Set(webhookTimestampHeader, ts)
+	req.Header.Set(webhookSignatureHeader, WebhookSignature(h.Secret, ts, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// deadLetter queues e to be stored as not delivered to h. It does
+// not block: the event is dropped if the dead letters queue is full.
+func (w *Webhooks) deadLetter(h *webhook, e Event, attempts int, err error) {
+	logger := w.logger.WithError(err).WithFields(logrus.Fields{
+		"webhook":  h.Name,
+		"event_id": e.ID,
+		"attempts": attempts,
+	})
+	d := DeadLetter{Webhook: h.Name, Event: e, Time: time.Now().UTC(), Attempts: attempts, Error: err.Error()}
+	select {
+	case w.deadQueue <- d:
+		promWebhookDeliveries.WithLabelValues(h.Name, "dead_lettered").Inc()
+		logger.Error("Webhook delivery failed, event added to dead letters")
+	default:
+		promWebhookDeliveries.WithLabelValues(h.Name, "dropped").Inc()
+		logger.Error("Webhook delivery failed and dead letters queue full, event dropped")
+	}
+}
+
+// storeDeadLetters stores the queued dead letters.
+func (w *Webhooks) storeDeadLetters() {
+	for d := range w.deadQueue {
+		if err := w.dead.Add(context.Background(), d); err != nil {
+			w.logger.WithError(err).WithFields(logrus.Fields{
+				"webhook":  d.Webhook,
+				"event_id": d.Event.ID,
+			}).Error("Unable to store dead letter")
+		}
+	}
+}
+
+// WebhookSignature returns the value of the X-Vulcan-Signature header
+// of a webhook request with the given X-Vulcan-Timestamp header and
+// body: the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with the secret, prefixed by "sha256=". Receivers should compare
+// it with hmac.Equal and reject the old timestamps.
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// RedisDeadLetters stores the dead letters in a capped Redis list.
+type RedisDeadLetters struct {
+	rdb    redis.UniversalClient
+	key    string
+	maxLen int64
+}
+
+// NewRedisDeadLetters returns the dead letters stored in
+// the Redis list configured in c.
+func NewRedisDeadLetters(db *RedisDB, c WebhooksConfig) *RedisDeadLetters {
+	return &RedisDeadLetters{rdb: db.rdb, key: c.DeadLetterKey, maxLen: c.MaxDeadLetters}
+}
+
+// Add pushes l to the list, dropping the oldest
+// dead letters beyond the maximum.
+func (d *RedisDeadLetters) Add(ctx context.Context, l DeadLetter) (err error) {
+	defer func(start time.Time) { observeStorageOp("dead_letter_add", start, err) }(time.Now())
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	pipe := d.rdb.TxPipeline()
+	pipe.LPush(ctx, d.key, data)
+	if d.maxLen > 0 {
+		pipe.LTrim(ctx, d.key, 0, d.maxLen-1)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// List returns the dead letters, newest first.
+func (d *RedisDeadLetters) List(ctx context.Context) (list []DeadLetter, err error) {
+	defer func(start time.Time) { observeStorageOp("dead_letter_list", start, err) }(time.Now())
+	items, err := d.rdb.LRange(ctx, d.key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	list = make([]DeadLetter, 0, len(items))
+	for _, item := range items {
+		var l DeadLetter
+		if err := json.Unmarshal([]byte(item), &l); err != nil {
+			return nil, err
+		}
+		list = append(list, l)
+	}
+	return list, nil
+}
+
+// WithWebhooks notifies w of the checks aborted and
+// of the agents connecting to and leaving the stream.
+func WithWebhooks(w *Webhooks) APIOption {
+	return func(a *API) {
+		a.webhooks = w
+		a.sender.SetEventHandler(w.Notify)
+	}
+}
+
+// deadLettersHandler returns the events that could not be delivered.
+func (a *API) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := a.webhooks.dead.List(r.Context())
+	if err != nil {
+		a.writeErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2026 Adevinta
+*/
+
+package stream
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// memDeadLetters keeps the dead letters in memory.
+type memDeadLetters struct {
+	mu   sync.Mutex
+	list []DeadLetter
+}
+
+func (d *memDeadLetters) Add(ctx context.Context, l DeadLetter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.list = append([]DeadLetter{l}, d.list...)
+	return nil
+}
+
+func (d *memDeadLetters) List(ctx context.Context) ([]DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeadLetter{}, d.list...), nil
+}
+
+// hookServer records the events received by a webhook, failing
+// the first fail requests.
+type hookServer struct {
+	*httptest.Server
+	secret string
+	events chan Event
+
+	mu   sync.Mutex
+	fail int
+}
+
+func newHookServer(t *testing.T, secret string, fail int) *hookServer {
+	s := &hookServer{secret: secret, events: make(chan Event, 100), fail: fail}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := WebhookSignature(s.secret, r.Header.Get(webhookTimestampHeader), body)
+		if !hmac.Equal([]byte(r.Header.Get(webhookSignatureHeader)), []byte(want)) {
+			t.Errorf("invalid webhook signature for %s", body)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		failing := s.fail > 0
+		s.fail--
+		s.mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("expected no error decoding event but got: %v", err)
+		}
+		if r.Header.Get(webhookEventHeader) != e.Type || r.Header.Get(webhookDeliveryHeader) != e.ID {
+			t.Errorf("unexpected webhook headers %v for %s", r.Header, body)
+		}
+		s.events <- e
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *hookServer) next(t *testing.T) Event {
+	t.Helper()
+	select {
+	case e := <-s.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected webhook event")
+	}
+	return Event{}
+}
+
+// blockedDeadLetters blocks storing the dead letters until released.
+type blockedDeadLetters struct {
+	memDeadLetters
+	release chan struct{}
+}
+
+func (d *blockedDeadLetters) Add(ctx context.Context, l DeadLetter) error {
+	<-d.release
+	return d.memDeadLetters.Add(ctx, l)
+}
+
+func TestNotifyDoesNotBlock(t *testing.T) {
+	dead := &blockedDeadLetters{release: make(chan struct{})}
+	hooks := []WebhookConfig{{Name: "slow", URL: "http://127.0.0.1:0"}}
+	wh := newWebhooks(WebhooksConfig{Timeout: 10, QueueSize: 1}, hooks, dead, log.New())
+	// The events are not delivered, so the queue of the
+	// webhook fills up, and the dead letters are not stored
+	// until released.
+	go wh.storeDeadLetters()
+
+	done := make(chan struct{})
+	go func() {
+		for range 5 {
+			wh.Notify(Event{Type: EventCheckAborted})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Notify not to block while storing the dead letters")
+	}
+
+	close(dead.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		list, _ := dead.List(context.Background())
+		if len(list) > 0 {
+			if l := list[0]; l.Webhook != "slow" || l.Error != errWebhookQueueFull.Error() {
+				t.Errorf("unexpected dead letter %+v", l)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the dead letters to be stored once released")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	aborts := newHookServer(t, "s1", 2)
+	agents := newHookServer(t, "s2", 0)
+	down := newHookServer(t, "s3", 100)
+
+	hooks := []WebhookConfig{
+		{Name: "aborts", URL: aborts.URL, Secret: "s1", Events: []string{EventCheckAborted}},
+		{Name: "agents", URL: agents.URL, Secret: "s2", Events: []string{"agent.*"}},
+		{Name: "down", URL: down.URL, Secret: "s3", Events: []string{EventCheckAborted}},
+	}
+	dead := &memDeadLetters{}
+	logger := log.New()
+	wh := newWebhooks(WebhooksConfig{MaxRetries: 2, Timeout: 10, QueueSize: 10}, hooks, dead, logger)
+	wh.backoff, wh.maxBackoff = time.Millisecond, 2*time.Millisecond
+	wh.start()
+
+	sender := NewSender(logger, SenderConfig{HTTPStream: "stream"})
+	api := NewAPI(0, sender, &recordStorage{}, logger, nopMetrics{}, WithWebhooks(wh))
+	srv := httptest.NewServer(api.mux)
+	defer srv.Close()
+
+	// The aborts are delivered after being retried.
+	resp, err := http.Post(srv.URL+"/abort", "application/json", strings.NewReader(`{"checks": ["c1", "c2"], "scan_id": "s1"}`))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected abort to succeed but got %v, error: %v", resp, err)
+	}
+	resp.Body.Close()
+	if e := aborts.next(t); e.Type != EventCheckAborted || strings.Join(e.CheckIDs, ",") != "c1,c2" || e.ScanID != "s1" {
+		t.Errorf("unexpected abort event %+v", e)
+	}
+
+	header := http.Header{"X-Agent-ID": {"agent-1"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream", header)
+	if err != nil {
+		t.Fatalf("expected no error connecting but got: %v", err)
+	}
+	if e := agents.next(t); e.Type != EventAgentConnected || e.AgentID != "agent-1" {
+		t.Errorf("unexpected connect event %+v", e)
+	}
+	conn.Close()
+	if e := agents.next(t); e.Type != EventAgentDisconnected || e.AgentID != "agent-1" {
+		t.Errorf("unexpected disconnect event %+v", e)
+	}
+
+	// The events that can't be delivered end up in the dead letters.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		api.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks/dead", nil))
+		var list []DeadLetter
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("expected no error decoding dead letters but got: %v", err)
+		}
+		if len(list) == 1 {
+			if l := list[0]; l.Webhook != "down" || l.Attempts != 3 || l.Event.Type != EventCheckAborted {
+				t.Errorf("unexpected dead letter %+v", l)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 1 dead letter but got %v", list)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAbortedEventsByScan(t *testing.T) {
+	logger := log.New()
+	hooks := []WebhookConfig{{Name: "aborts", URL: "http://127.0.0.1", Secret: "s1"}}
+	// The webhooks are not started, so the events stay queued.
+	wh := newWebhooks(WebhooksConfig{Timeout: 10, QueueSize: 10}, hooks, &memDeadLetters{}, logger)
+	api := NewAPI(0, NewSender(logger, SenderConfig{HTTPStream: "stream"}), &recordStorage{}, logger, nopMetrics{}, WithWebhooks(wh))
+
+	msgs := append(abortMessages([]string{"c1", "c2"}, "s1"), abortMessages([]string{"c3"}, "s2")...)
+	msgs = append(msgs, abortMessages([]string{"c4"}, "s1")...)
+	if err := api.dispatch(context.Background(), "stream", msgs); err != nil {
+		t.Fatalf("expected no error dispatching messages but got: %v", err)
+	}
+
+	want := []Event{
+		{Type: EventCheckAborted, CheckIDs: []string{"c1", "c2", "c4"}, ScanID: "s1"},
+		{Type: EventCheckAborted, CheckIDs: []string{"c3"}, ScanID: "s2"},
+	}
+	queue := wh.hooks[0].queue
+	if len(queue) != len(want) {
+		t.Fatalf("expected %d events but got %d", len(want), len(queue))
+	}
+	for _, w := range want {
+		e := <-queue
+		if e.Type != w.Type || e.ScanID != w.ScanID || strings.Join(e.CheckIDs, ",") != strings.Join(w.CheckIDs, ",") {
+			t.Errorf("expected event %+v but got %+v", w, e)
+		}
+	}
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	t.Setenv("TEST_WEBHOOK_SECRET", "secret")
+	testCases := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{
+			name: "Valid",
+			file: `
+[[Webhook]]
+Name = "reporting"
+URL = "https://reporting.example.com/hooks"
+SecretEnv = "TEST_WEBHOOK_SECRET"
+Events = ["check.aborted", "agent.*"]
+`,
+		},
+		{
+			name: "Unknown event",
+			file: `
+[[Webhook]]
+Name = "reporting"
+URL = "https://reporting.example.com/hooks"
+Secret = "secret"
+Events = ["check.created"]
+`,
+			wantErr: "unknown event",
+		},
+		{
+			name: "Without secret",
+			file: `
+[[Webhook]]
+Name = "reporting"
+URL = "https://reporting.example.com/hooks"
+`,
+			wantErr: "secret is required",
+		},
+		{
+			name: "Invalid URL",
+			file: `
+[[Webhook]]
+Name = "reporting"
+URL = "reporting.example.com"
+Secret = "secret"
+`,
+			wantErr: "invalid URL",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "webhooks.toml")
+			if err := os.WriteFile(path, []byte(tc.file), 0600); err != nil {
+				t.Fatal(err)
+			}
+			hooks, err := LoadWebhooks(path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q but got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if len(hooks) != 1 || hooks[0].Secret != "secret" {
+				t.Errorf("unexpected webhooks %+v", hooks)
+			}
+		})
+	}
+}